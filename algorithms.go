@@ -0,0 +1,214 @@
+package gossh
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 本文件提供了 ssh 包所支持的算法列表、预置的算法配置以及对 Config 中算法名称的校验。
+// ssh 包会忽略或者在握手时才拒绝无法识别的算法名称，拼写错误只会表现为难以理解的握手失败
+
+var (
+	supportedKeyExchanges = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+		"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1",
+	}
+	supportedCiphers = []string{
+		"chacha20-poly1305@openssh.com", "aes128-gcm@openssh.com",
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+		"aes128-cbc", "3des-cbc",
+		"arcfour256", "arcfour128", "arcfour",
+	}
+	supportedMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-256", "hmac-sha1", "hmac-sha1-96",
+	}
+	supportedHostKeyAlgorithms = []string{
+		ssh.CertAlgoED25519v01, ssh.CertAlgoECDSA256v01, ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01,
+		ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01,
+		ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+	}
+)
+
+// SupportedKeyExchanges 返回可用于 Config.KeyExchanges 的密钥交换算法
+func SupportedKeyExchanges() []string {
+	return append([]string(nil), supportedKeyExchanges...)
+}
+
+// SupportedCiphers 返回可用于 Config.Ciphers 的加密算法
+func SupportedCiphers() []string {
+	return append([]string(nil), supportedCiphers...)
+}
+
+// SupportedMACs 返回可用于 Config.MACs 的消息摘要算法
+func SupportedMACs() []string {
+	return append([]string(nil), supportedMACs...)
+}
+
+// SupportedHostKeyAlgorithms 返回可用于 Config.HostKeyAlgorithms 的主机公钥签名算法
+func SupportedHostKeyAlgorithms() []string {
+	return append([]string(nil), supportedHostKeyAlgorithms...)
+}
+
+// 预置的算法配置名称
+const (
+	ProfileModern           = "modern"            // 仅使用目前被认为安全的算法
+	ProfileCompatibleLegacy = "compatible-legacy" // 在 modern 之后追加 SHA-1、CBC、RC4 以及 DSA 等旧算法，用于连接老旧的设备
+	ProfileFIPSLike         = "fips-like"         // 仅使用 NIST 曲线、AES 以及 SHA-2 系列算法，不代表经过 FIPS 140 认证
+)
+
+// AlgorithmProfile 一组预置的算法列表，各列表按照优先级排列
+type AlgorithmProfile struct {
+	Name              string
+	KeyExchanges      []string
+	Ciphers           []string
+	MACs              []string
+	HostKeyAlgorithms []string
+}
+
+var (
+	modernKeyExchanges = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256",
+	}
+	modernCiphers = []string{
+		"chacha20-poly1305@openssh.com", "aes128-gcm@openssh.com",
+		"aes256-ctr", "aes192-ctr", "aes128-ctr",
+	}
+	modernMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-256",
+	}
+	modernHostKeyAlgorithms = []string{
+		ssh.CertAlgoED25519v01, ssh.CertAlgoECDSA256v01, ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01,
+		ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01,
+		ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256,
+	}
+)
+
+var algorithmProfiles = []AlgorithmProfile{
+	{
+		Name:              ProfileModern,
+		KeyExchanges:      modernKeyExchanges,
+		Ciphers:           modernCiphers,
+		MACs:              modernMACs,
+		HostKeyAlgorithms: modernHostKeyAlgorithms,
+	},
+	{
+		Name: ProfileCompatibleLegacy,
+		KeyExchanges: append(append([]string(nil), modernKeyExchanges...),
+			"diffie-hellman-group-exchange-sha256", "diffie-hellman-group14-sha1",
+			"diffie-hellman-group-exchange-sha1", "diffie-hellman-group1-sha1"),
+		Ciphers: append(append([]string(nil), modernCiphers...),
+			"aes128-cbc", "3des-cbc", "arcfour256", "arcfour128", "arcfour"),
+		MACs: append(append([]string(nil), modernMACs...),
+			"hmac-sha1", "hmac-sha1-96"),
+		HostKeyAlgorithms: append(append([]string(nil), modernHostKeyAlgorithms...),
+			ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01, ssh.KeyAlgoRSA, ssh.KeyAlgoDSA),
+	},
+	{
+		Name: ProfileFIPSLike,
+		KeyExchanges: []string{
+			"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+			"diffie-hellman-group-exchange-sha256", "diffie-hellman-group14-sha256",
+		},
+		Ciphers: []string{
+			"aes128-gcm@openssh.com", "aes256-ctr", "aes192-ctr", "aes128-ctr",
+		},
+		MACs: []string{
+			"hmac-sha2-256-etm@openssh.com", "hmac-sha2-256",
+		},
+		HostKeyAlgorithms: []string{
+			ssh.CertAlgoECDSA256v01, ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01,
+			ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01,
+			ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+			ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256,
+		},
+	},
+}
+
+// AlgorithmProfileNames 返回所有预置算法配置的名称
+func AlgorithmProfileNames() []string {
+	names := make([]string, 0, len(algorithmProfiles))
+	for _, profile := range algorithmProfiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+// LookupAlgorithmProfile 根据名称查找预置的算法配置，返回的列表可以随意修改
+func LookupAlgorithmProfile(name string) (AlgorithmProfile, bool) {
+	for _, profile := range algorithmProfiles {
+		if profile.Name == name {
+			return AlgorithmProfile{
+				Name:              profile.Name,
+				KeyExchanges:      append([]string(nil), profile.KeyExchanges...),
+				Ciphers:           append([]string(nil), profile.Ciphers...),
+				MACs:              append([]string(nil), profile.MACs...),
+				HostKeyAlgorithms: append([]string(nil), profile.HostKeyAlgorithms...),
+			}, true
+		}
+	}
+	return AlgorithmProfile{}, false
+}
+
+// Apply 以该配置中的算法列表替换 config 中的 KeyExchanges、Ciphers、MACs 以及 HostKeyAlgorithms
+func (profile AlgorithmProfile) Apply(config *Config) {
+	config.KeyExchanges = append([]string(nil), profile.KeyExchanges...)
+	config.Ciphers = append([]string(nil), profile.Ciphers...)
+	config.MACs = append([]string(nil), profile.MACs...)
+	config.HostKeyAlgorithms = append([]string(nil), profile.HostKeyAlgorithms...)
+}
+
+// Validate 检查 config 中的算法名称是否均被支持，nil 列表表示使用默认值，不做检查。
+// 存在无法识别的名称或者列表为空时返回的错误中将列出所有问题以及支持的算法；
+// Connect 不会调用该方法，需要在连接前自行调用
+func (config *Config) Validate() error {
+	if config == nil {
+		return errors.New("invalid config")
+	}
+	var problems []string
+	check := func(field string, list, supported []string) {
+		if list == nil {
+			return
+		}
+		if len(list) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: empty algorithm list", field))
+			return
+		}
+		var unknown []string
+		for _, algo := range list {
+			if !containsString(supported, algo) {
+				unknown = append(unknown, fmt.Sprintf("%q", algo))
+			}
+		}
+		if len(unknown) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: unsupported %s (supported: %s)",
+				field, strings.Join(unknown, ", "), strings.Join(supported, ", ")))
+		}
+	}
+	check("KeyExchanges", config.KeyExchanges, supportedKeyExchanges)
+	check("Ciphers", config.Ciphers, supportedCiphers)
+	check("MACs", config.MACs, supportedMACs)
+	check("HostKeyAlgorithms", config.HostKeyAlgorithms, supportedHostKeyAlgorithms)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package gossh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestAlgorithmProfilesAreSupported(t *testing.T) {
+	names := AlgorithmProfileNames()
+	if len(names) != 3 {
+		t.Fatalf("profiles = %q", names)
+	}
+	for _, name := range names {
+		profile, ok := LookupAlgorithmProfile(name)
+		if !ok {
+			t.Fatalf("profile %s not found", name)
+		}
+		config := &Config{}
+		profile.Apply(config)
+		if err := config.Validate(); err != nil {
+			t.Errorf("profile %s: %v", name, err)
+		}
+	}
+	if _, ok := LookupAlgorithmProfile("unknown"); ok {
+		t.Error("unknown profile found")
+	}
+}
+
+func TestLookupAlgorithmProfileReturnsCopy(t *testing.T) {
+	profile, _ := LookupAlgorithmProfile(ProfileModern)
+	profile.Ciphers[0] = "changed"
+	config := &Config{}
+	profile.Apply(config)
+	profile.MACs[0] = "changed"
+
+	again, _ := LookupAlgorithmProfile(ProfileModern)
+	if again.Ciphers[0] == "changed" {
+		t.Error("modifying a looked up profile changed the preset")
+	}
+	if config.MACs[0] == "changed" {
+		t.Error("modifying a profile after Apply changed the config")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr []string
+	}{
+		{name: "defaults", config: &Config{}},
+		{name: "supported", config: &Config{Ciphers: []string{"aes128-ctr"}, MACs: []string{"hmac-sha2-256"}}},
+		{name: "nil", config: nil, wantErr: []string{"invalid config"}},
+		{name: "empty", config: &Config{KeyExchanges: []string{}}, wantErr: []string{"KeyExchanges: empty algorithm list"}},
+		{
+			name:    "unknown",
+			config:  &Config{Ciphers: []string{"aes128-ctr", "rot13"}, HostKeyAlgorithms: []string{"ssh-foo"}},
+			wantErr: []string{`Ciphers: unsupported "rot13"`, `HostKeyAlgorithms: unsupported "ssh-foo"`, "supported: "},
+		},
+	}
+	for _, tt := range tests {
+		err := tt.config.Validate()
+		if len(tt.wantErr) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+			continue
+		}
+		for _, want := range tt.wantErr {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q does not contain %q", tt.name, err, want)
+			}
+		}
+	}
+}
+
+func TestConnectWithAlgorithmProfiles(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecSigner, err := ssh.NewSignerFromKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fips-like 不包含 ed25519，服务端额外提供一个 ECDSA 主机私钥
+	server := startTestServer(t, ecSigner)
+	for _, name := range AlgorithmProfileNames() {
+		profile, _ := LookupAlgorithmProfile(name)
+		config := testConfig(IgnoreHostKey)
+		profile.Apply(config)
+		client, err := Connect(server.addr, config)
+		if err != nil {
+			t.Errorf("profile %s: %v", name, err)
+			continue
+		}
+		info := client.ConnectionInfo()
+		if !containsString(profile.KeyExchanges, info.KeyExchange) || !containsString(profile.Ciphers, info.CipherClientToServer) {
+			t.Errorf("profile %s negotiated %s %s", name, info.KeyExchange, info.CipherClientToServer)
+		}
+		client.Close()
+	}
+}
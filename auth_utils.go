@@ -5,9 +5,10 @@ import (
 	"fmt"
 	"golang.org/x/crypto/ssh/agent"
 	"golang.org/x/crypto/ssh/knownhosts"
-	"io/ioutil"
+	"io"
 	"net"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"golang.org/x/crypto/ssh"
@@ -19,6 +20,13 @@ import (
 type KnownHostsChecker struct {
 	files         []string
 	Interactively bool
+	AcceptNew     bool // known_hosts 中没有该主机的记录时不经询问直接接受并记录，与 Open-SSH 的 StrictHostKeyChecking accept-new 相同
+
+	Input  io.Reader // 交互式询问时读取回答的来源，为 nil 时为 os.Stdin
+	Output io.Writer // 交互式询问时提示信息的写入目标，为 nil 时为 os.Stderr，以免与会话的标准输出混在一起
+	Logger Logger    // 记录验证结果，为 nil 时不记录
+
+	Authorities []ssh.PublicKey // 除 known_hosts 中的 @cert-authority 记录以外，受信任的主机证书 CA 公钥，对所有主机有效
 }
 
 const (
@@ -27,38 +35,15 @@ const (
 )
 
 // AuthByPrivateKeysFromPaths 从给定的文件中加载私钥并生成 Signer，并生成 ssh.AuthMethod 认证方法.
-// 任何一个文件解析失败都将返回一个不为 nil 的错误
+// 任何一个文件解析失败都将返回一个不为 nil 的错误；私钥被加密时返回 *ssh.PassphraseMissingError，
+// 此时可以使用 AuthByPrivateKeysFromPathsWithPassphrase
 func AuthByPrivateKeysFromPaths(files ...string) (ssh.AuthMethod, error) {
-	var signers []ssh.Signer
-	for _, file := range files {
-		// 读取密钥文件
-		bytes, err := ioutil.ReadFile(file)
-		if err != nil {
-			return nil, err
-		}
-		// 解析ssh 私钥
-		signer, err := ssh.ParsePrivateKey(bytes)
-		if err != nil {
-			return nil, err
-		}
-		signers = append(signers, signer)
-	}
-	return ssh.PublicKeys(signers...), nil
+	return AuthByPrivateKeysFromPathsWithPassphrase(nil, files...)
 }
 
+// AuthByPrivateKeys 由给定的私钥内容生成 ssh.AuthMethod 认证方法，私钥被加密时可以使用 AuthByPrivateKeysWithPassphrase
 func AuthByPrivateKeys(keys ...[]byte) (ssh.AuthMethod, error) {
-	var signers []ssh.Signer
-	for _, key := range keys {
-		// 读取密钥文件
-
-		// 解析ssh 私钥
-		signer, err := ssh.ParsePrivateKey(key)
-		if err != nil {
-			return nil, err
-		}
-		signers = append(signers, signer)
-	}
-	return ssh.PublicKeys(signers...), nil
+	return AuthByPrivateKeysWithPassphrase(nil, keys...)
 }
 
 // ReadPasswordAuth 从标准输入中获取输入密码进行认证
@@ -71,19 +56,19 @@ func ReadPasswordAuth(prompt ...string) (AuthMethod, error) {
 	if err != nil {
 		return nil, fmt.Errorf("read passwd failed: %s", err)
 	}
-	return ssh.Password(string(password)), nil
+	return passwordAuth(string(password)), nil
 }
 
 // PasswordAuth 由给定的密码进行认证
 func PasswordAuth(passwd string) AuthMethod {
-	return ssh.Password(passwd)
+	return passwordAuth(passwd)
 }
 
 // SSHAgentAuth ssh-agent 身份验证
 func SSHAgentAuth() (AuthMethod, error) {
 	sshAgent, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
 	if err == nil {
-		return ssh.PublicKeysCallback(agent.NewClient(sshAgent).Signers), nil
+		return publicKeysCallbackAuth("agent:"+os.Getenv("SSH_AUTH_SOCK"), agent.NewClient(sshAgent).Signers), nil
 	}
 	return nil, err
 }
@@ -110,61 +95,170 @@ func NewKnownHostCallback(interactively bool, files ...string) func(hostname str
 	}).KnownHostsCheck
 }
 
-// KnownHostsCheck 对 hostname 、remote 与 key 进行 known_hosts 匹配。
-// 如果接收器的 interactively 为 true，将会以交互式方式询问是否接受此次连接，并将
+// KnownHostsCheck 对 hostname 、remote 与 key 进行 known_hosts 匹配，不存在的 known_hosts 文件视为空文件。
+// known_hosts 中没有该主机的记录时，如果接收器的 Interactively 为 true，将显示主机公钥的 SHA256 指纹并询问是否接受此次连接，
+// 接受后以 [host]:port 的形式将主机公钥追加至第一个 known_hosts 文件（文件不存在时将被创建），否则返回 *HostKeyError；
+// AcceptNew 为 true 时不经询问直接接受并记录；
+// 主机公钥与记录不符时总是返回 Want 不为空的 *HostKeyError，交互模式下还将输出可能遭受中间人攻击的警告以及冲突记录所在的位置
 func (kw KnownHostsChecker) KnownHostsCheck(hostname string, remote net.Addr, key PublicKey) error {
 	if kw.files == nil || len(kw.files) == 0 {
 		return errors.New("no known_hosts file given")
 	}
+	logger := kw.logger()
 
-	callback, err := knownhosts.New(kw.files...)
+	callback, err := kw.loadKnownHosts()
 	if err != nil {
-		if rErr, ok := err.(*knownhosts.RevokedError); ok {
-			if kw.Interactively {
-				fmt.Println("revoked key found")
-			}
-			return rErr
-		}
 		return err
 	}
 
-	err = callback(hostname, remote, key)
-	if err != nil {
-		return err
+	if cert, ok := key.(*ssh.Certificate); ok {
+		err = kw.checkKnownHostsCert(callback, hostname, remote, cert)
+	} else {
+		err = callback(hostname, remote, key)
 	}
-
-	if !kw.Interactively {
+	if err == nil {
+		logger.Log(LevelDebug, "host key accepted", "host", hostname, "fingerprint", ssh.FingerprintSHA256(key))
 		return nil
 	}
 
-	fmt.Printf("No host key found in %s, continue? [yes/NO]\r\n", kw.files)
-	answer := "no"
-	_, err = fmt.Scan(&answer)
-	if err != nil {
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		var revokedErr *knownhosts.RevokedError
+		if errors.As(err, &revokedErr) {
+			logger.Log(LevelWarn, "revoked host key", "host", hostname, "file", revokedErr.Revoked.Filename, "line", revokedErr.Revoked.Line)
+		} else {
+			logger.Log(LevelWarn, "host key check failed", "host", hostname, "remote", remote, "error", err)
+		}
 		return err
 	}
-	if strings.ToLower(answer) == "yes" {
-		answer = "no"
-		fmt.Printf("Append %s@%s 's host key into '%s'? [YES/no] ", hostname, remote.String(), kw.files[0])
-		_, err = fmt.Scan(&answer)
-		if err != nil {
-			return err
+	hostKeyErr := &HostKeyError{Host: hostname, Remote: remote, Key: key, Want: keyErr.Want, Err: keyErr}
+
+	if len(keyErr.Want) > 0 {
+		for _, known := range keyErr.Want {
+			logger.Log(LevelWarn, "host key mismatch", "host", hostname, "fingerprint", ssh.FingerprintSHA256(key),
+				"file", known.Filename, "line", known.Line)
 		}
-		if strings.ToLower(answer) == "no" {
-			return nil
+		if kw.Interactively {
+			kw.warnHostKeyChanged(hostname, key, keyErr.Want)
 		}
-		if answer == "yes" {
-			file, err := os.OpenFile(kw.files[0], os.O_WRONLY|os.O_APPEND, 0600)
-			line := knownhosts.Line([]string{remote.String()}, key)
-			_, err = file.WriteString(line + "\n")
-			if err != nil {
-				fmt.Printf("Add host key to %s failed: %s\r\n", kw.files[0], err)
+		return hostKeyErr
+	}
+
+	logger.Log(LevelWarn, "unknown host key", "host", hostname, "fingerprint", ssh.FingerprintSHA256(key))
+	if !kw.Interactively && !kw.AcceptNew {
+		return hostKeyErr
+	}
+	if !kw.AcceptNew {
+		accepted, err := kw.askUnknownHost(hostname, remote, key)
+		if err != nil || !accepted {
+			hostKeyErr.Err = err
+			if err == nil {
+				hostKeyErr.Err = errors.New("host key not accepted")
 			}
+			return hostKeyErr
 		}
-		return nil
+	}
+	if err := kw.appendKnownHost(hostname, key); err != nil {
+		logger.Log(LevelError, "append host key failed", "file", kw.files[0], "error", err)
+		fmt.Fprintf(kw.output(), "Add host key to %s failed: %s\r\n", kw.files[0], err)
 	} else {
-		return errors.New("unknown host")
+		logger.Log(LevelInfo, "host key appended", "host", hostname, "file", kw.files[0])
+	}
+	return nil
+}
+
+// loadKnownHosts 读取所有存在的 known_hosts 文件
+func (kw KnownHostsChecker) loadKnownHosts() (ssh.HostKeyCallback, error) {
+	var files []string
+	for _, file := range kw.files {
+		if _, err := os.Stat(file); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return knownhosts.New(files...)
+}
+
+// askUnknownHost 显示主机公钥的指纹并询问是否接受，回答 yes 或者指纹本身时接受
+func (kw KnownHostsChecker) askUnknownHost(hostname string, remote net.Addr, key PublicKey) (bool, error) {
+	out := kw.output()
+	fingerprint := ssh.FingerprintSHA256(key)
+	host := knownhosts.Normalize(hostname)
+	if remote != nil && knownhosts.Normalize(remote.String()) != host {
+		host = fmt.Sprintf("%s (%s)", host, remote)
+	}
+	fmt.Fprintf(out, "The authenticity of host '%s' can't be established.\r\n", host)
+	fmt.Fprintf(out, "%s key fingerprint is %s.\r\n", key.Type(), fingerprint)
+	fmt.Fprint(out, "Are you sure you want to continue connecting (yes/no/[fingerprint])? ")
+	for {
+		var answer string
+		if _, err := fmt.Fscan(kw.input(), &answer); err != nil {
+			return false, fmt.Errorf("read answer failed: %w", err)
+		}
+		switch {
+		case strings.ToLower(answer) == "yes" || answer == fingerprint:
+			return true, nil
+		case strings.ToLower(answer) == "no":
+			return false, nil
+		}
+		fmt.Fprint(out, "Please type 'yes', 'no' or the fingerprint: ")
+	}
+}
+
+// warnHostKeyChanged 输出主机公钥与 known_hosts 中的记录不符的警告
+func (kw KnownHostsChecker) warnHostKeyChanged(hostname string, key PublicKey, want []knownhosts.KnownKey) {
+	out := kw.output()
+	fmt.Fprint(out, "@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@\r\n")
+	fmt.Fprint(out, "@    WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED!     @\r\n")
+	fmt.Fprint(out, "@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@\r\n")
+	fmt.Fprint(out, "IT IS POSSIBLE THAT SOMEONE IS DOING SOMETHING NASTY!\r\n")
+	fmt.Fprint(out, "Someone could be eavesdropping on you right now (man-in-the-middle attack)!\r\n")
+	fmt.Fprintf(out, "The %s key sent by %s has fingerprint %s.\r\n", key.Type(), knownhosts.Normalize(hostname), ssh.FingerprintSHA256(key))
+	for _, known := range want {
+		fmt.Fprintf(out, "Offending %s key in %s:%d (%s)\r\n", known.Key.Type(), known.Filename, known.Line, ssh.FingerprintSHA256(known.Key))
+	}
+}
+
+// appendKnownHost 以 [host]:port 的形式将主机公钥追加至第一个 known_hosts 文件，文件及其目录不存在时将被创建。
+// 主机证书将以其中的主机公钥记录
+func (kw KnownHostsChecker) appendKnownHost(hostname string, key PublicKey) error {
+	var hostKey ssh.PublicKey = key
+	if cert, ok := key.(*ssh.Certificate); ok {
+		hostKey = cert.Key
+	}
+	file := kw.files[0]
+
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(knownhosts.Line([]string{hostname}, hostKey) + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (kw KnownHostsChecker) input() io.Reader {
+	if kw.Input == nil {
+		return os.Stdin
+	}
+	return kw.Input
+}
+
+func (kw KnownHostsChecker) output() io.Writer {
+	if kw.Output == nil {
+		return os.Stderr
 	}
+	return kw.Output
 }
 
 //// 在known_hosts文件中查找主机名对应的公钥。如果存在对应host的记录，则 error 为空
@@ -0,0 +1,137 @@
+package gossh
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestKnownHostsCheck(t *testing.T) {
+	const hostname = "127.0.0.1:2222"
+	remote := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2222}
+	key := newTestSigner(t).PublicKey()
+	fingerprint := ssh.FingerprintSHA256(key)
+	line := "[127.0.0.1]:2222 " + authorizedKey(key)
+
+	t.Run("unknown host", func(t *testing.T) {
+		checker := KnownHostsChecker{files: []string{filepath.Join(t.TempDir(), "known_hosts")}}
+		err := checker.KnownHostsCheck(hostname, remote, key)
+		var hostKeyErr *HostKeyError
+		if !errors.As(err, &hostKeyErr) || len(hostKeyErr.Want) != 0 {
+			t.Fatalf("err = %v, want *HostKeyError without Want", err)
+		}
+		if !errors.Is(err, ErrUnknownHost) || errors.Is(err, ErrHostKeyMismatch) {
+			t.Errorf("err = %v, want ErrUnknownHost", err)
+		}
+	})
+
+	t.Run("known host", func(t *testing.T) {
+		checker := KnownHostsChecker{files: []string{writeKnownHosts(t, line)}}
+		if err := checker.KnownHostsCheck(hostname, remote, key); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	answers := []struct{ name, answer string }{
+		{"yes", "yes"},
+		{"fingerprint", fingerprint},
+		{"invalid answer then yes", "maybe\nYES"},
+	}
+	for _, tt := range answers {
+		answer := tt.answer
+		t.Run("accept "+tt.name, func(t *testing.T) {
+			// 文件及其目录不存在时将被创建
+			file := filepath.Join(t.TempDir(), "ssh", "known_hosts")
+			var out bytes.Buffer
+			checker := KnownHostsChecker{files: []string{file}, Interactively: true,
+				Input: strings.NewReader(answer + "\n"), Output: &out}
+			if err := checker.KnownHostsCheck(hostname, remote, key); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out.String(), fingerprint) {
+				t.Errorf("prompt does not show the fingerprint:\n%s", out.String())
+			}
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(string(data)) != line {
+				t.Errorf("known_hosts = %q, want %q", data, line)
+			}
+			checker.Interactively = false
+			if err := checker.KnownHostsCheck(hostname, remote, key); err != nil {
+				t.Errorf("check after accepting: %v", err)
+			}
+		})
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "known_hosts")
+		checker := KnownHostsChecker{files: []string{file}, Interactively: true,
+			Input: strings.NewReader("no\n"), Output: ioutil.Discard}
+		if err := checker.KnownHostsCheck(hostname, remote, key); !errors.Is(err, ErrUnknownHost) {
+			t.Fatalf("err = %v, want ErrUnknownHost", err)
+		}
+		if _, err := ioutil.ReadFile(file); err == nil {
+			t.Error("known_hosts created after rejecting")
+		}
+	})
+
+	t.Run("changed host key", func(t *testing.T) {
+		file := writeKnownHosts(t, "# comment", line)
+		var out bytes.Buffer
+		other := newTestSigner(t).PublicKey()
+		checker := KnownHostsChecker{files: []string{file}, Interactively: true,
+			Input: strings.NewReader("yes\n"), Output: &out}
+		err := checker.KnownHostsCheck(hostname, remote, other)
+		var hostKeyErr *HostKeyError
+		if !errors.As(err, &hostKeyErr) || !errors.Is(err, ErrHostKeyMismatch) {
+			t.Fatalf("err = %v, want ErrHostKeyMismatch", err)
+		}
+		if len(hostKeyErr.Want) != 1 || hostKeyErr.Want[0].Filename != file || hostKeyErr.Want[0].Line != 2 {
+			t.Errorf("Want = %+v", hostKeyErr.Want)
+		}
+		if !strings.Contains(out.String(), "REMOTE HOST IDENTIFICATION HAS CHANGED") ||
+			!strings.Contains(out.String(), ssh.FingerprintSHA256(other)) {
+			t.Errorf("missing warning:\n%s", out.String())
+		}
+		// 主机公钥改变时不应询问，也不应修改 known_hosts
+		data, _ := ioutil.ReadFile(file)
+		if strings.Contains(string(data), authorizedKey(other)) {
+			t.Error("changed host key appended to known_hosts")
+		}
+	})
+
+	t.Run("accept new", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "known_hosts")
+		var out bytes.Buffer
+		checker := KnownHostsChecker{files: []string{file}, AcceptNew: true, Input: strings.NewReader(""), Output: &out}
+		if err := checker.KnownHostsCheck(hostname, remote, key); err != nil {
+			t.Fatal(err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("prompted for a new host key:\n%s", out.String())
+		}
+		if data, _ := ioutil.ReadFile(file); strings.TrimSpace(string(data)) != line {
+			t.Errorf("known_hosts = %q, want %q", data, line)
+		}
+		// 与记录不符的公钥仍然被拒绝
+		if err := checker.KnownHostsCheck(hostname, remote, newTestSigner(t).PublicKey()); !errors.Is(err, ErrHostKeyMismatch) {
+			t.Errorf("err = %v, want ErrHostKeyMismatch", err)
+		}
+	})
+}
+
+func TestKnownHostsCheckerDefaultOutput(t *testing.T) {
+	// 提示信息默认写入标准错误输出，不与会话的标准输出混在一起
+	if output := (KnownHostsChecker{}).output(); output != os.Stderr {
+		t.Errorf("default output = %v, want os.Stderr", output)
+	}
+}
@@ -0,0 +1,120 @@
+package gossh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 本文件实现了由 gossh 构造的身份认证方法：ssh 包中的认证方法无法从外部拦截，也无法得知其类型以及所使用的身份，
+// 因此构造函数在生成 ssh.AuthMethod 的同时记录方法的名称与身份，并保留以回调函数重新生成该方法的方式，
+// 用于在握手时得知方法何时被尝试，以及计算连接池的配置指纹
+
+// authMethod gossh 的构造函数返回的身份认证方法
+type authMethod struct {
+	ssh.AuthMethod
+	name     string                              // SSH 协议中的方法名称，例如 password、publickey
+	identity string                              // 所使用的身份，例如公钥的指纹；为空时只有同一个实例被视为相同的身份
+	observe  func(attempt func()) ssh.AuthMethod // 生成一个等价的认证方法，每次尝试该方法时调用 attempt
+}
+
+// id 用于比较认证方法的身份
+func (m *authMethod) id() string {
+	if m.identity == "" {
+		return fmt.Sprintf("%s:%p", m.name, m)
+	}
+	return m.name + ":" + m.identity
+}
+
+// passwordAuth 使用固定密码的 password 认证方法，身份为密码的摘要
+func passwordAuth(password string) *authMethod {
+	sum := sha256.Sum256([]byte(password))
+	callback := func(attempt func()) ssh.AuthMethod {
+		return ssh.PasswordCallback(func() (string, error) {
+			attempt()
+			return password, nil
+		})
+	}
+	return &authMethod{
+		AuthMethod: ssh.Password(password),
+		name:       "password",
+		identity:   hex.EncodeToString(sum[:]),
+		observe:    callback,
+	}
+}
+
+// publicKeysAuth 使用给定 Signer 的 publickey 认证方法，身份为各个公钥的指纹
+func publicKeysAuth(signers ...ssh.Signer) *authMethod {
+	callback := func(attempt func()) ssh.AuthMethod {
+		return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			attempt()
+			return signers, nil
+		})
+	}
+	return &authMethod{
+		AuthMethod: ssh.PublicKeys(signers...),
+		name:       "publickey",
+		identity:   signersIdentity(signers),
+		observe:    callback,
+	}
+}
+
+// publicKeysCallbackAuth 在认证时才通过 getSigners 获取 Signer 的 publickey 认证方法，例如 ssh-agent
+func publicKeysCallbackAuth(identity string, getSigners func() ([]ssh.Signer, error)) *authMethod {
+	callback := func(attempt func()) ssh.AuthMethod {
+		return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			attempt()
+			return getSigners()
+		})
+	}
+	return &authMethod{
+		AuthMethod: ssh.PublicKeysCallback(getSigners),
+		name:       "publickey",
+		identity:   identity,
+		observe:    callback,
+	}
+}
+
+// keyboardInteractiveAuth keyboard-interactive 认证方法。
+// 服务端直接拒绝而没有发出任何问题时无法得知该方法被尝试过；一次握手中多次尝试该方法也只被记录一次
+func keyboardInteractiveAuth(challenge ssh.KeyboardInteractiveChallenge) *authMethod {
+	callback := func(attempt func()) ssh.AuthMethod {
+		asked := false
+		return ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			if !asked {
+				asked = true
+				attempt()
+			}
+			return challenge(name, instruction, questions, echos)
+		})
+	}
+	return &authMethod{
+		AuthMethod: ssh.KeyboardInteractive(challenge),
+		name:       "keyboard-interactive",
+		observe:    callback,
+	}
+}
+
+// retryableAuth 与 ssh.RetryableAuthMethod 相同，每一次重试都被视为一次尝试
+func retryableAuth(m *authMethod, maxTries int) *authMethod {
+	return &authMethod{
+		AuthMethod: ssh.RetryableAuthMethod(m.AuthMethod, maxTries),
+		name:       m.name,
+		identity:   fmt.Sprintf("%s|retry:%d", m.id(), maxTries),
+		observe: func(attempt func()) ssh.AuthMethod {
+			return ssh.RetryableAuthMethod(m.observe(attempt), maxTries)
+		},
+	}
+}
+
+// signersIdentity 各个公钥的 SHA256 指纹
+func signersIdentity(signers []ssh.Signer) string {
+	fingerprints := make([]string, 0, len(signers))
+	for _, signer := range signers {
+		fingerprints = append(fingerprints, ssh.FingerprintSHA256(signer.PublicKey()))
+	}
+	return strings.Join(fingerprints, ",")
+}
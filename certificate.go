@@ -0,0 +1,154 @@
+package gossh
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// 本文件实现了 Open-SSH 用户证书认证：私钥与 CA 签发的证书（通常为私钥路径加上 -cert.pub 后缀）配对，
+// 或者使用 ssh-agent 中保存的证书
+
+var (
+	ErrCertificateExpired     = errors.New("certificate has expired")      // 证书已过期
+	ErrCertificateNotYetValid = errors.New("certificate is not yet valid") // 证书尚未生效
+)
+
+// CertificateWarningCallback 证书已过期或者尚未生效时被调用，err 为 ErrCertificateExpired 或者 ErrCertificateNotYetValid。
+// 证书的有效期由服务端验证，过期的证书仍然会被尝试
+type CertificateWarningCallback func(cert *ssh.Certificate, err error)
+
+// CertificatePath 返回私钥 keyFile 对应的证书路径，即 keyFile + "-cert.pub"
+func CertificatePath(keyFile string) string {
+	return keyFile + "-cert.pub"
+}
+
+// ParseCertificate 解析 authorized_keys 格式（即 *-cert.pub 文件的格式）的用户证书
+func ParseCertificate(data []byte) (*ssh.Certificate, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a certificate", pub.Type())
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, errors.New("not a user certificate")
+	}
+	return cert, nil
+}
+
+// CheckCertificateValidity 检查证书在 now 时是否处于有效期内，返回 ErrCertificateExpired 或者 ErrCertificateNotYetValid
+func CheckCertificateValidity(cert *ssh.Certificate, now time.Time) error {
+	unix := now.Unix()
+	if unix < 0 {
+		unix = 0
+	}
+	if uint64(unix) < cert.ValidAfter {
+		return fmt.Errorf("%w: valid after %s", ErrCertificateNotYetValid, time.Unix(int64(cert.ValidAfter), 0).Format(time.RFC3339))
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity && uint64(unix) >= cert.ValidBefore {
+		return fmt.Errorf("%w: valid before %s", ErrCertificateExpired, time.Unix(int64(cert.ValidBefore), 0).Format(time.RFC3339))
+	}
+	return nil
+}
+
+// AuthByCertificateFromPaths 加载私钥 keyFile 以及证书 certFile 生成证书认证方法，certFile 为空时使用 CertificatePath(keyFile)。
+// 证书之后也会尝试私钥本身；私钥被加密时通过 provider 获取口令；证书已过期或者尚未生效时调用 warn（可以为 nil）
+func AuthByCertificateFromPaths(keyFile, certFile string, provider PassphraseProvider, warn CertificateWarningCallback) (AuthMethod, error) {
+	if certFile == "" {
+		certFile = CertificatePath(keyFile)
+	}
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := parsePrivateKey(key, keyFile, provider)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := ParseCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate %s: %w", certFile, err)
+	}
+	certSigner, err := newCertSigner(cert, signer, warn)
+	if err != nil {
+		return nil, fmt.Errorf("certificate %s: %w", certFile, err)
+	}
+	return publicKeysAuth(certSigner, signer), nil
+}
+
+// AuthByCertificate 由私钥以及证书的内容生成证书认证方法，参数的含义与 AuthByCertificateFromPaths 相同
+func AuthByCertificate(key, cert []byte, provider PassphraseProvider, warn CertificateWarningCallback) (AuthMethod, error) {
+	signer, err := parsePrivateKey(key, "", provider)
+	if err != nil {
+		return nil, err
+	}
+	certificate, err := ParseCertificate(cert)
+	if err != nil {
+		return nil, err
+	}
+	certSigner, err := newCertSigner(certificate, signer, warn)
+	if err != nil {
+		return nil, err
+	}
+	return publicKeysAuth(certSigner, signer), nil
+}
+
+// SSHAgentCertificateAuth 仅使用 ssh-agent 中保存的证书进行认证，证书已过期或者尚未生效时调用 warn（可以为 nil）
+func SSHAgentCertificateAuth(warn CertificateWarningCallback) (AuthMethod, error) {
+	sshAgent, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+	if err != nil {
+		return nil, err
+	}
+	client := agent.NewClient(sshAgent)
+	return publicKeysCallbackAuth("agent-certificates:"+os.Getenv("SSH_AUTH_SOCK"), func() ([]ssh.Signer, error) {
+		signers, err := client.Signers()
+		if err != nil {
+			return nil, err
+		}
+		var certSigners []ssh.Signer
+		for _, signer := range signers {
+			if !strings.Contains(signer.PublicKey().Type(), "-cert-") {
+				continue
+			}
+			if cert, err := ParseCertificate(ssh.MarshalAuthorizedKey(signer.PublicKey())); err == nil {
+				warnCertificate(cert, warn)
+				certSigners = append(certSigners, signer)
+			}
+		}
+		return certSigners, nil
+	}), nil
+}
+
+// newCertSigner 检查证书与私钥是否匹配，并生成证书 Signer
+func newCertSigner(cert *ssh.Certificate, signer ssh.Signer, warn CertificateWarningCallback) (ssh.Signer, error) {
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, err
+	}
+	warnCertificate(cert, warn)
+	return certSigner, nil
+}
+
+// warnCertificate 证书不在有效期内时调用 warn
+func warnCertificate(cert *ssh.Certificate, warn CertificateWarningCallback) {
+	if warn == nil {
+		return
+	}
+	if err := CheckCertificateValidity(cert, time.Now()); err != nil {
+		warn(cert, err)
+	}
+}
@@ -0,0 +1,196 @@
+package gossh
+
+import (
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestUserCert 使用 ca 为 key 签发一个用户证书，返回 *-cert.pub 格式的内容
+func newTestUserCert(t *testing.T, ca ssh.Signer, key ssh.PublicKey, validAfter, validBefore uint64) []byte {
+	t.Helper()
+	cert := &ssh.Certificate{
+		Key:             key,
+		KeyId:           "test-user",
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"tester"},
+		ValidAfter:      validAfter,
+		ValidBefore:     validBefore,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	return ssh.MarshalAuthorizedKey(cert)
+}
+
+// startCertServer 启动只接受由 ca 签发的用户证书的测试服务端，返回地址以及被接受的公钥类型
+func startCertServer(t *testing.T, ca ssh.PublicKey) (string, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var accepted []string
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return string(auth.Marshal()) == string(ca.Marshal())
+		},
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			perms, err := checker.Authenticate(conn, key)
+			if err == nil {
+				mu.Lock()
+				accepted = append(accepted, key.Type())
+				mu.Unlock()
+			}
+			return perms, err
+		},
+	}
+	config.AddHostKey(newTestSigner(t))
+	addr := listenTestTCP(t, func(conn net.Conn) { serveTestConn(conn, config) })
+	return addr, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), accepted...)
+	}
+}
+
+func TestParseCertificate(t *testing.T) {
+	ca := newTestSigner(t)
+	_, signer := newTestPrivateKey(t)
+	cert, err := ParseCertificate(newTestUserCert(t, ca, signer.PublicKey(), 0, ssh.CertTimeInfinity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.KeyId != "test-user" || cert.CertType != ssh.UserCert {
+		t.Errorf("cert = %+v", cert)
+	}
+
+	if _, err := ParseCertificate(ssh.MarshalAuthorizedKey(signer.PublicKey())); err == nil || !strings.Contains(err.Error(), "not a certificate") {
+		t.Errorf("plain key: err = %v", err)
+	}
+	hostCert := &ssh.Certificate{Key: signer.PublicKey(), CertType: ssh.HostCert, ValidBefore: ssh.CertTimeInfinity}
+	if err := hostCert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseCertificate(ssh.MarshalAuthorizedKey(hostCert)); err == nil || !strings.Contains(err.Error(), "not a user certificate") {
+		t.Errorf("host certificate: err = %v", err)
+	}
+	if _, err := ParseCertificate([]byte("garbage")); err == nil {
+		t.Error("expected an error for garbage")
+	}
+}
+
+func TestCheckCertificateValidity(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	unix := uint64(now.Unix())
+	tests := []struct {
+		name                    string
+		validAfter, validBefore uint64
+		want                    error
+	}{
+		{name: "forever", validAfter: 0, validBefore: ssh.CertTimeInfinity},
+		{name: "valid", validAfter: unix - 60, validBefore: unix + 60},
+		{name: "starts now", validAfter: unix, validBefore: unix + 60},
+		{name: "not yet valid", validAfter: unix + 1, validBefore: unix + 60, want: ErrCertificateNotYetValid},
+		{name: "expired", validAfter: 0, validBefore: unix - 60, want: ErrCertificateExpired},
+		{name: "expires now", validAfter: 0, validBefore: unix, want: ErrCertificateExpired},
+	}
+	for _, tt := range tests {
+		cert := &ssh.Certificate{ValidAfter: tt.validAfter, ValidBefore: tt.validBefore}
+		err := CheckCertificateValidity(cert, now)
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestAuthByCertificate(t *testing.T) {
+	ca := newTestSigner(t)
+	addr, accepted := startCertServer(t, ca.PublicKey())
+	key, signer := newTestPrivateKey(t)
+	cert := newTestUserCert(t, ca, signer.PublicKey(), 0, ssh.CertTimeInfinity)
+
+	var warned int
+	auth, err := AuthByCertificate(key, cert, nil, func(cert *ssh.Certificate, err error) { warned++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{User: "tester", Auth: []AuthMethod{auth}, HostKeyCallback: IgnoreHostKey}
+	client, err := Connect(addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if got := accepted(); len(got) != 1 || got[0] != ssh.CertAlgoECDSA256v01 {
+		t.Errorf("accepted keys = %q, want the certificate", got)
+	}
+	if warned != 0 {
+		t.Errorf("warned %d times for a valid certificate", warned)
+	}
+
+	// 证书与私钥不匹配
+	otherKey, _ := newTestPrivateKey(t)
+	if _, err := AuthByCertificate(otherKey, cert, nil, nil); err == nil {
+		t.Error("expected an error for a mismatched private key")
+	}
+}
+
+func TestAuthByCertificateExpired(t *testing.T) {
+	ca := newTestSigner(t)
+	addr, _ := startCertServer(t, ca.PublicKey())
+	key, signer := newTestPrivateKey(t)
+	expired := newTestUserCert(t, ca, signer.PublicKey(), 0, uint64(time.Now().Add(-time.Hour).Unix()))
+
+	// 过期的证书仍然被尝试，并由服务端拒绝
+	var warnings []error
+	auth, err := AuthByCertificate(key, expired, nil, func(cert *ssh.Certificate, err error) {
+		warnings = append(warnings, err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !errors.Is(warnings[0], ErrCertificateExpired) {
+		t.Errorf("warnings = %v, want ErrCertificateExpired", warnings)
+	}
+	config := &Config{User: "tester", Auth: []AuthMethod{auth}, HostKeyCallback: IgnoreHostKey}
+	if _, err := Connect(addr, config); err == nil {
+		t.Error("expected the server to reject an expired certificate")
+	}
+}
+
+func TestAuthByCertificateFromPaths(t *testing.T) {
+	ca := newTestSigner(t)
+	addr, _ := startCertServer(t, ca.PublicKey())
+	dir := t.TempDir()
+	key, signer := newTestPrivateKey(t)
+	encrypted := filepath.Join(dir, "id_ecdsa")
+	if err := ioutil.WriteFile(encrypted, encryptTestKey(t, key, "pass"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	certFile := CertificatePath(encrypted)
+	if err := ioutil.WriteFile(certFile, newTestUserCert(t, ca, signer.PublicKey(), 0, ssh.CertTimeInfinity), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// certFile 为空时使用 keyFile-cert.pub；私钥被加密时通过 provider 获取口令
+	auth, err := AuthByCertificateFromPaths(encrypted, "", func(file string) ([]byte, error) { return []byte("pass"), nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Connect(addr, &Config{User: "tester", Auth: []AuthMethod{auth}, HostKeyCallback: IgnoreHostKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if _, err := AuthByCertificateFromPaths(encrypted, filepath.Join(dir, "missing-cert.pub"), nil, nil); err == nil {
+		t.Error("expected an error for a missing certificate")
+	}
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nishoushun/gossh"
+	"golang.org/x/crypto/ssh"
+)
+
+// 本文件根据连接错误的类型输出提示信息，并以不同的退出码退出
+
+// 退出码
+const (
+	exitError           = 1 // 其它错误
+	exitConfig          = 2 // 配置有误
+	exitDial            = 3 // 无法建立网络连接
+	exitDialTimeout     = 4 // 建立网络连接超时
+	exitUnknownHost     = 5 // known_hosts 中没有该主机的记录
+	exitHostKeyMismatch = 6 // 主机公钥与 known_hosts 中的记录不符
+	exitAuthFailed      = 7 // 身份认证失败
+	exitAlgorithm       = 8 // 没有共同支持的算法
+	exitHandshake       = 9 // 其它握手错误
+)
+
+// exitWithConfigError 输出配置错误并退出
+func exitWithConfigError(err error) {
+	fmt.Fprintf(os.Stderr, "Invalid configuration: %s\r\n", err)
+	os.Exit(exitConfig)
+}
+
+// exitWithConnectError 根据连接错误的类型输出提示信息并退出
+func exitWithConnectError(err error) {
+	message, code := describeConnectError(err)
+	fmt.Fprintf(os.Stderr, "%s\r\n", message)
+	os.Exit(code)
+}
+
+// describeConnectError 返回连接错误的提示信息以及对应的退出码
+func describeConnectError(err error) (string, int) {
+	var (
+		dialErr    *gossh.DialError
+		authErr    *gossh.AuthError
+		hostKeyErr *gossh.HostKeyError
+		algoErr    *gossh.AlgorithmError
+		handErr    *gossh.HandshakeError
+	)
+	switch {
+	case errors.As(err, &hostKeyErr) && errors.Is(err, gossh.ErrHostKeyMismatch):
+		// 交互模式下 KnownHostsChecker 已经输出了完整的警告，这里只给出冲突的记录
+		var b strings.Builder
+		fmt.Fprintf(&b, "Host key verification failed: the host key of %s (%s %s) does not match\r\n",
+			hostKeyErr.Host, hostKeyErr.Key.Type(), ssh.FingerprintSHA256(hostKeyErr.Key))
+		for _, known := range hostKeyErr.Want {
+			fmt.Fprintf(&b, "  %s:%d (%s %s)\r\n", known.Filename, known.Line, known.Key.Type(), ssh.FingerprintSHA256(known.Key))
+		}
+		b.WriteString("Remove the offending lines from known_hosts if the change is expected.")
+		return b.String(), exitHostKeyMismatch
+	case errors.As(err, &hostKeyErr):
+		message := fmt.Sprintf("The host key of %s is not known", hostKeyErr.Host)
+		if hostKeyErr.Key != nil {
+			message += fmt.Sprintf(" (%s %s)", hostKeyErr.Key.Type(), ssh.FingerprintSHA256(hostKeyErr.Key))
+		}
+		return message + ", add it to --known-hosts or use --ignore-host-key.", exitUnknownHost
+	case errors.As(err, &authErr):
+		methods := "none"
+		if len(authErr.Methods) > 0 {
+			methods = strings.Join(authErr.Methods, ", ")
+		}
+		return fmt.Sprintf("Permission denied for %s (tried: %s).", authErr.User, methods), exitAuthFailed
+	case errors.As(err, &algoErr):
+		return fmt.Sprintf("No matching %s algorithm, the server offers: %s. Try a profile like --cipher compatible-legacy.",
+			algoErr.What, strings.Join(algoErr.Server, ", ")), exitAlgorithm
+	case errors.As(err, &handErr):
+		return fmt.Sprintf("SSH handshake with %s failed: %s", handErr.Addr, handErr.Err), exitHandshake
+	case errors.As(err, &dialErr) && errors.Is(err, gossh.ErrDialTimeout):
+		return fmt.Sprintf("Connection to %s timed out.", dialErr.Addr), exitDialTimeout
+	case errors.As(err, &dialErr):
+		return fmt.Sprintf("Could not connect to %s: %s", dialErr.Addr, dialErr.Err), exitDial
+	}
+	return fmt.Sprintf("An error occurred: %s", err), exitError
+}
@@ -12,6 +12,7 @@ require (
     github.com/alecthomas/units v0.0.0-20211218093645-b94a6e3cc137 // indirect
     github.com/stretchr/testify v1.7.1 // indirect
     gopkg.in/alecthomas/kingpin.v2 v2.2.6
+    gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 replace github.com/nishoushun/gossh => ../
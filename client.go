@@ -1,32 +1,389 @@
 package gossh
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"golang.org/x/crypto/ssh"
 	"io"
 	"net"
+	"os"
+	"strings"
 	"sync"
 	"time"
 )
 
 // SSHClient 对 ssh.Client 的一层包装
 type SSHClient struct {
+	// 原子访问的 64 位字段必须位于结构体开头，以保证在 32 位平台上按 8 字节对齐
+	rtt  int64 // 最近一次 keepalive 请求的往返时间，需要原子地访问
+	srtt int64 // 平滑后的往返时间，需要原子地访问
+
 	c *ssh.Client
 	ssh.Conn
 	sync.Mutex
+
+	parentMu sync.Mutex
+	parent   *SSHClient // 经由跳板机建立连接时所使用的上一跳连接，本连接关闭或者断开后将被一并关闭
+
+	closed chan struct{} // 连接断开后被关闭
+	config *Config       // 建立连接时使用的配置
+	addr   string        // 建立连接时使用的目标地址
+
+	reasonMu sync.Mutex
+	reason   error // 连接断开的原因，见 DisconnectEvent
+
+	metrics *clientMetrics // 启用 Config.Metrics 时的计数器
+
+	hostKey    PublicKey   // 握手时通过验证的服务端主机公钥
+	kexSniffer *kexSniffer // 截取首次密钥交换的 KEXINIT，见 ConnectionInfo
+
+	handlersMu      sync.RWMutex
+	requestHandlers map[string]GlobalRequestHandler
+	channelHandlers map[string]ChannelHandler
+
+	registry registry
 }
 
-// Connect 使用提供的配置选项与目标建立 SSH 连接
+// JumpHost 描述一个跳板机，Config 为 nil 时将使用目标主机的配置进行连接
+type JumpHost struct {
+	Addr   string
+	Config *Config
+}
+
+// DefaultTimeout Config.Timeout 未设置时建立网络连接的默认超时时间
+const DefaultTimeout = 15 * time.Second
+
+// Connect 使用提供的配置选项与目标建立 SSH 连接。
+// 如果 config.JumpHosts 不为空，将依次连接各个跳板机，并经由最后一个跳板机连接至目标，
+// 关闭返回的 SSHClient 或者目标断开连接时，整条连接链将从目标开始依次关闭。
 func Connect(addr string, config *Config) (*SSHClient, error) {
+	return ConnectContext(context.Background(), addr, config)
+}
+
+// ConnectContext 与 Connect 相同，但可以通过 ctx 终止连接的建立。
+// ctx 被取消或超时时，无论处于网络连接建立阶段还是 SSH 握手、身份认证阶段，都将中断并关闭底层连接；
+// 建立网络连接的超时时间由 config.Timeout 控制，握手以及身份认证的超时时间由 config.HandshakeTimeout 控制。
+func ConnectContext(ctx context.Context, addr string, config *Config) (*SSHClient, error) {
 	if config == nil {
 		return nil, errors.New("invalid config")
 	}
 
-	if config.ClientVersion == "" {
-		config.ClientVersion = "SSH-2.0-GoSSH"
+	if config.ControlPath != "" {
+		if client := connectControlPath(ctx, addr, config); client != nil {
+			return client, nil
+		}
+	}
+
+	if len(config.JumpHosts) == 0 {
+		return dialContext(ctx, addr, config)
+	}
+
+	var hop *SSHClient
+	for i, jump := range config.JumpHosts {
+		if jump == nil {
+			continue
+		}
+		hopConfig := jump.Config
+		if hopConfig == nil {
+			hopConfig = config
+		}
+		next, err := connectVia(ctx, hop, jump.Addr, hopConfig)
+		if err != nil {
+			if hop != nil {
+				hop.Close()
+			}
+			return nil, fmt.Errorf("connect to jump host %d (%s) failed: %w", i+1, jump.Addr, err)
+		}
+		hop = next
 	}
 
-	clientConfig := &ssh.ClientConfig{
+	client, err := connectVia(ctx, hop, addr, config)
+	if err != nil {
+		if hop != nil {
+			hop.Close()
+		}
+		return nil, err
+	}
+	return client, nil
+}
+
+// connectControlPath 尝试经由 config.ControlPath 上运行的 master 建立连接，没有可用的 master 时返回 nil
+func connectControlPath(ctx context.Context, addr string, config *Config) *SSHClient {
+	path, err := ExpandProxyCommand(config.ControlPath, addr, config.User)
+	if err != nil {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	client, err := ConnectControlContext(ctx, path, config)
+	if err != nil {
+		return nil
+	}
+	return client
+}
+
+// ConnectThrough 通过已经建立的 SSH 连接 jump 打开一个 direct-tcpip 通道至 addr，并在该通道上与目标建立 SSH 连接，
+// 效果等同于 Open-SSH 的 ProxyJump。
+// 关闭返回的 SSHClient 不会关闭 jump，jump 的生命周期由调用者管理。
+func ConnectThrough(jump *SSHClient, addr string, config *Config) (*SSHClient, error) {
+	return ConnectThroughContext(context.Background(), jump, addr, config)
+}
+
+// ConnectThroughContext 与 ConnectThrough 相同，但可以通过 ctx 终止通道的打开以及 SSH 握手
+func ConnectThroughContext(ctx context.Context, jump *SSHClient, addr string, config *Config) (*SSHClient, error) {
+	if jump == nil {
+		return nil, errors.New("invalid jump host client")
+	}
+	if config == nil {
+		return nil, errors.New("invalid config")
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, dialTimeout(config))
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	// 打开 direct-tcpip 通道不支持 context，在单独的协程中进行，放弃等待时由该协程负责关闭迟到的连接
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := jump.Dial("tcp", addr)
+		ch <- result{conn, err}
+	}()
+
+	select {
+	case <-dialCtx.Done():
+		go func() {
+			if r := <-ch; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		err := &DialError{Addr: addr, Via: jump.RemoteAddr().String(), Err: dialCtx.Err()}
+		observerOf(config).OnConnect(ConnectEvent{Addr: addr, User: config.User, Err: err})
+		return nil, err
+	case r := <-ch:
+		if r.err != nil {
+			err := &DialError{Addr: addr, Via: jump.RemoteAddr().String(), Err: r.err}
+			observerOf(config).OnConnect(ConnectEvent{Addr: addr, User: config.User, Err: err})
+			return nil, err
+		}
+		return handshakeContext(ctx, r.conn, addr, config)
+	}
+}
+
+// connectVia 经由 hop 连接至 addr，hop 为 nil 时直接连接，否则 hop 的所有权将转移至返回的 SSHClient
+func connectVia(ctx context.Context, hop *SSHClient, addr string, config *Config) (*SSHClient, error) {
+	if hop == nil {
+		return dialContext(ctx, addr, config)
+	}
+	client, err := ConnectThroughContext(ctx, hop, addr, config)
+	if err != nil {
+		return nil, err
+	}
+	client.setParent(hop)
+	return client, nil
+}
+
+// setParent 设置上一跳连接，本连接已经断开时立即关闭 hop
+func (client *SSHClient) setParent(hop *SSHClient) {
+	client.parentMu.Lock()
+	client.parent = hop
+	client.parentMu.Unlock()
+	select {
+	case <-client.closed:
+		hop.Close()
+	default:
+	}
+}
+
+// closeParent 关闭上一跳连接
+func (client *SSHClient) closeParent() {
+	client.parentMu.Lock()
+	parent := client.parent
+	client.parentMu.Unlock()
+	if parent != nil {
+		parent.Close()
+	}
+}
+
+// dialContext 直接与目标建立 tcp 连接并完成 SSH 握手
+func dialContext(ctx context.Context, addr string, config *Config) (*SSHClient, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, dialTimeout(config))
+	defer cancel()
+
+	conn, err := dialerOf(config)(dialCtx, "tcp", addr)
+	if err != nil {
+		err = &DialError{Addr: addr, Err: err}
+		observerOf(config).OnConnect(ConnectEvent{Addr: addr, User: config.User, Err: err})
+		return nil, err
+	}
+	return handshakeContext(ctx, conn, addr, config)
+}
+
+// dialerOf 根据 config 中的 Dialer、Proxy 以及 ProxyCommand 得到建立网络连接的函数
+func dialerOf(config *Config) DialFunc {
+	dialer := config.Dialer
+	if dialer == nil {
+		dialer = (&net.Dialer{}).DialContext
+	}
+	if config.Proxy != nil {
+		dialer = config.Proxy.Dialer(dialer)
+	}
+	if config.ProxyCommand != "" {
+		dialer = ProxyCommandDialer(config.ProxyCommand, config.User, config.ProxyCommandStderr)
+	}
+	return dialer
+}
+
+// NewClientFromConn 在调用者已经建立的网络连接 conn 上与 addr 完成 SSH 握手以及身份认证，
+// 可用于经由 SOCKS 代理、WebSocket 隧道或者内存管道等方式建立的连接。
+// addr 将被用于主机公钥验证；握手失败时 conn 将被关闭，成功后 conn 的生命周期由返回的 SSHClient 管理。
+func NewClientFromConn(conn net.Conn, addr string, config *Config) (*SSHClient, error) {
+	if conn == nil {
+		return nil, errors.New("invalid conn")
+	}
+	if config == nil {
+		conn.Close()
+		return nil, errors.New("invalid config")
+	}
+	return handshakeContext(context.Background(), conn, addr, config)
+}
+
+// handshakeContext 在 conn 上完成 SSH 握手以及身份认证，ctx 被取消或超过 config.HandshakeTimeout 时关闭 conn 以中断握手
+func handshakeContext(ctx context.Context, conn net.Conn, addr string, config *Config) (*SSHClient, error) {
+	if config.HandshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.HandshakeTimeout)
+		defer cancel()
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		// 并不是所有的 net.Conn 都支持 deadline，例如 direct-tcpip 通道，此时仅依靠关闭连接来中断握手
+		conn.SetDeadline(deadline)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	client, err := newSSHClient(conn, addr, config)
+	close(done)
+	if deadline, ok := ctx.Deadline(); ok && err != nil && !time.Now().Before(deadline) {
+		// 连接的 deadline 与 ctx 相同，可能先于 ctx 到期，此时等待 ctx 到期以返回相同的错误
+		<-ctx.Done()
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		if client != nil {
+			client.Close()
+		}
+		client, err = nil, &HandshakeError{Addr: addr, Err: fmt.Errorf("aborted: %w", ctxErr)}
+	}
+	observerOf(config).OnConnect(ConnectEvent{Addr: addr, User: config.User, Client: client, Err: err})
+	if err != nil {
+		loggerOf(config).Log(LevelDebug, "ssh handshake failed", "addr", addr, "user", config.User, "error", err)
+		return nil, err
+	}
+	loggerOf(config).Log(LevelDebug, "ssh connection established", "addr", addr, "user", config.User, "server_version", string(client.ServerVersion()))
+	conn.SetDeadline(time.Time{})
+	return client, nil
+}
+
+// dialTimeout 建立网络连接的超时时间
+func dialTimeout(config *Config) time.Duration {
+	if config.Timeout > 0 {
+		return config.Timeout
+	}
+	return DefaultTimeout
+}
+
+// newSSHClient 在已经建立的网络连接上完成 SSH 握手，握手失败时 conn 将被关闭
+func newSSHClient(conn net.Conn, addr string, config *Config) (_ *SSHClient, err error) {
+	clientConfig := newClientConfig(config)
+	tracker := &authTracker{addr: addr, user: config.User}
+	clientConfig.Auth = tracker.wrap(clientConfig.Auth)
+	if observing(config) {
+		observer := observerOf(config)
+		tracker.observer = observer
+		clientConfig.HostKeyCallback = observeHostKeyCallback(observer, clientConfig.HostKeyCallback)
+		defer func() {
+			tracker.finish(err)
+		}()
+	}
+	state := handshakeState{addr: addr, user: config.User, remote: conn.RemoteAddr(), tracker: tracker}
+	if callback := clientConfig.HostKeyCallback; callback != nil {
+		clientConfig.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			err := callback(hostname, remote, key)
+			state.hostKey, state.hostKeyErr = key, err
+			return err
+		}
+	}
+	var metrics *clientMetrics
+	if config.Metrics != nil {
+		conn, metrics = config.Metrics.instrumentConn(conn)
+	}
+	sniffer := newKexSniffer(conn)
+	conn = sniffer
+	state.sniffer = sniffer
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, handshakeError(state, err)
+	}
+	// 全局请求与服务端打开的通道先经由注册的处理函数分发，未处理的通道再交由 ssh.Client
+	unhandled := make(chan ssh.NewChannel)
+	noRequests := make(chan *ssh.Request)
+	close(noRequests)
+	cli := ssh.NewClient(c, unhandled, noRequests)
+	client := &SSHClient{
+		c:          cli,
+		Conn:       cli.Conn,
+		Mutex:      sync.Mutex{},
+		closed:     make(chan struct{}),
+		config:     config,
+		addr:       addr,
+		metrics:    metrics,
+		hostKey:    state.hostKey,
+		kexSniffer: sniffer,
+	}
+	client.initHandlers(config)
+	go client.handleGlobalRequests(reqs)
+	go client.handleChannels(chans, unhandled)
+	if config.Metrics != nil {
+		config.Metrics.addClient(client)
+	}
+	go func() {
+		err := cli.Wait()
+		close(client.closed)
+		// 目标断开后跳板机连接不再有用
+		client.closeParent()
+		client.registry.release()
+		if config.Metrics != nil {
+			config.Metrics.removeClient(client)
+		}
+		client.observer().OnDisconnect(DisconnectEvent{Client: client, Addr: addr, Reason: client.disconnectReason(err)})
+	}()
+	if config.KeepAlive != nil {
+		client.KeepAlive(*config.KeepAlive)
+	}
+	return client, nil
+}
+
+// newClientConfig 将 Config 转换为 ssh.ClientConfig
+func newClientConfig(config *Config) *ssh.ClientConfig {
+	clientVersion := config.ClientVersion
+	if clientVersion == "" {
+		clientVersion = "SSH-2.0-GoSSH"
+	}
+
+	return &ssh.ClientConfig{
 		Config: ssh.Config{
 			Rand:           config.Rand,
 			RekeyThreshold: config.RekeyThreshold,
@@ -38,20 +395,18 @@ func Connect(addr string, config *Config) (*SSHClient, error) {
 		Auth:              WrapAuthMethodSlice(config.Auth),
 		HostKeyCallback:   WrapHostKeyCallback(config.HostKeyCallback),
 		BannerCallback:    WrapBannerCallback(config.BannerCallback),
-		ClientVersion:     config.ClientVersion,
+		ClientVersion:     clientVersion,
 		HostKeyAlgorithms: config.HostKeyAlgorithms,
-		Timeout:           15 * time.Second,
-	}
-	cli, err := ssh.Dial("tcp", addr, clientConfig)
-	if err != nil {
-		return nil, err
+		Timeout:           config.Timeout,
 	}
+}
 
-	return &SSHClient{
-		c:     cli,
-		Conn:  cli.Conn,
-		Mutex: sync.Mutex{},
-	}, err
+// Close 关闭 SSH 连接；如果该连接经由跳板机建立，之后将依次关闭跳板机连接
+func (client *SSHClient) Close() error {
+	client.setCloseReason(ErrClosedByClient)
+	err := client.c.Close()
+	client.closeParent()
+	return err
 }
 
 // Client 获取原始的 ssh.Client
@@ -61,19 +416,73 @@ func (client *SSHClient) Client() *ssh.Client {
 
 // OpenSession 打开一个新的 session 通道
 func (client *SSHClient) OpenSession() (*Session, error) {
+	if client.registry.closing() {
+		return nil, ErrShuttingDown
+	}
 	sess, err := client.c.NewSession()
+	if err != nil {
+		if client.observed() {
+			client.observer().OnChannelOpen(ChannelEvent{Client: client, Type: "session", Err: err})
+		}
+		return nil, err
+	}
+	untrack, err := client.track(Resource{Kind: ResourceSession, Type: "session"}, sess.Close)
 	if err != nil {
 		return nil, err
 	}
-	return &Session{
-		sess:  sess,
-		Mutex: sync.Mutex{},
-	}, nil
+	session := &Session{
+		sess:    sess,
+		Mutex:   sync.Mutex{},
+		untrack: untrack,
+	}
+	if client.observed() {
+		observer := client.observer()
+		event := ChannelEvent{Client: client, Type: "session"}
+		observer.OnChannelOpen(event)
+		var once sync.Once
+		session.onClose = func() {
+			once.Do(func() {
+				observer.OnChannelClose(event)
+			})
+		}
+	}
+	if client.config != nil && len(client.config.SendEnv) > 0 {
+		for _, env := range os.Environ() {
+			i := strings.IndexByte(env, '=')
+			if i <= 0 || !matchEnvPatterns(client.config.SendEnv, env[:i]) {
+				continue
+			}
+			// 服务端通常只接受 AcceptEnv 中列出的环境变量，被拒绝时忽略
+			session.SetEnv(env[:i], env[i+1:])
+		}
+	}
+	return session, nil
 }
 
 // OpenChannel 请求建立一个新的 ssh 通道
 func (client *SSHClient) OpenChannel(name string, extraData []byte) (Channel, <-chan *ssh.Request, error) {
-	return client.Conn.OpenChannel(name, extraData)
+	if client.registry.closing() {
+		return nil, nil, ErrShuttingDown
+	}
+	channel, reqs, err := client.Conn.OpenChannel(name, extraData)
+	if client.observed() {
+		observer := client.observer()
+		event := ChannelEvent{Client: client, Type: name, Err: err}
+		observer.OnChannelOpen(event)
+		if err == nil {
+			channel = &observedChannel{Channel: channel, close: func() {
+				observer.OnChannelClose(event)
+			}}
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	untrack, err := client.track(Resource{Kind: ResourceChannel, Type: name}, channel.Close)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &trackedChannel{Channel: channel, untrack: untrack}, reqs, nil
 }
 
 // NewDirector 创建一个 Director
@@ -88,14 +497,24 @@ func (client *SSHClient) NewDirector() *Director {
 // addr 应为远程服务端可访问的网络接口。
 // 一个经典的应用就是 Open-SSH 的 ssh -L 端口转发
 func (client *SSHClient) Dial(netType, addr string) (net.Conn, error) {
-	return client.c.Dial(netType, addr)
+	if client.registry.closing() {
+		return nil, ErrShuttingDown
+	}
+	conn, err := client.c.Dial(netType, addr)
+	conn, err = client.observeDial(conn, err, netType, addr)
+	return client.trackConn(conn, err, channelTypeOf(netType), addr)
 }
 
 // DialTCP 发送 direct-tcpip 通道建立请求，通过已经建立的 SSH 连接，建立TCP连接至远程端口。
 // netType 为网络类型 tcp、tcp4、tcp6 之一；
 // laddr 表示 tcp 请求来源，如果为 nil，将使用 '0.0.0.0:0'；raddr 为远程服务端可访问的地址以及端口
 func (client *SSHClient) DialTCP(netType string, laddr, raddr *net.TCPAddr) (net.Conn, error) {
-	return client.c.DialTCP(netType, laddr, raddr)
+	if client.registry.closing() {
+		return nil, ErrShuttingDown
+	}
+	conn, err := client.c.DialTCP(netType, laddr, raddr)
+	conn, err = client.observeDial(conn, err, netType, raddr.String())
+	return client.trackConn(conn, err, "direct-tcpip", raddr.String())
 }
 
 // Listen 发送 tcpip-forward 通道建立请求，通过本次建立的 SSH 信道，任何对 SSH 服务器上目标地址端口的访问都将被转发至本地，
@@ -103,17 +522,32 @@ func (client *SSHClient) DialTCP(netType string, laddr, raddr *net.TCPAddr) (net
 // netType 为网络类型 tcp、tcp4、tcp6 以及 unix 之一。
 // 一个最经典的应用就是 Open-SSH 的 ssh -R 端口转发，发送至远程目标端口的连接与数据都将被转发至返回的监听器。
 func (client *SSHClient) Listen(netType, addr string) (net.Listener, error) {
-	return client.c.Listen(netType, addr)
+	if client.registry.closing() {
+		return nil, ErrShuttingDown
+	}
+	listener, err := client.c.Listen(netType, addr)
+	listener, err = client.observeListener(listener, err, netType, addr)
+	return client.trackListener(listener, err, netType)
 }
 
 // ListenTcp 类似于 Listen ，但是监听远程系统的 Tcp 端口，返回监听器，
 func (client *SSHClient) ListenTcp(laddr *net.TCPAddr) (net.Listener, error) {
-	return client.c.ListenTCP(laddr)
+	if client.registry.closing() {
+		return nil, ErrShuttingDown
+	}
+	listener, err := client.c.ListenTCP(laddr)
+	listener, err = client.observeListener(listener, err, "tcp", laddr.String())
+	return client.trackListener(listener, err, "tcp")
 }
 
 // ListenUnix 类似于 Listen ，监听远程 unix 系统的 unix socket
 func (client *SSHClient) ListenUnix(socketPath string) (net.Listener, error) {
-	return client.c.ListenUnix(socketPath)
+	if client.registry.closing() {
+		return nil, ErrShuttingDown
+	}
+	listener, err := client.c.ListenUnix(socketPath)
+	listener, err = client.observeListener(listener, err, "unix", socketPath)
+	return client.trackListener(listener, err, "unix")
 }
 
 // Config ssh 包下的 ClientConfig 的包装
@@ -130,5 +564,27 @@ type Config struct {
 	BannerCallback    BannerCallback  // 身份认证前对服务端发送的 Banner 信息的处理。注意，并不是所有的服务端都会发送该信息
 	ClientVersion     string          // 必须以 'SSH-1.0-' 或者 'SSH-2.0-' 开头，如果为空，将被替换为 'SSH-2.0-GoSSH'
 	HostKeyAlgorithms []string
-	Timeout           time.Duration // 建立 tcp 连接超时时间
+	Timeout           time.Duration // 建立网络连接的超时时间，为 0 时使用 DefaultTimeout
+	HandshakeTimeout  time.Duration // SSH 握手以及身份认证的超时时间，为 0 时不做限制
+	Dialer            DialFunc      // 建立与目标（或第一个跳板机）之间的网络连接，为 nil 时直接建立 tcp 连接
+	Proxy             *ProxyConfig  // 出站代理，不为 nil 时将经由代理服务器建立网络连接，与代理服务器之间的连接由 Dialer 建立
+
+	ProxyCommand       string    // 类似于 Open-SSH 的 ProxyCommand，以本地命令的标准输入、输出作为传输通道，支持 %h、%p、%r；设置后 Dialer 与 Proxy 将被忽略
+	ProxyCommandStderr io.Writer // ProxyCommand 进程标准错误输出的写入目标，为 nil 时丢弃
+
+	JumpHosts []*JumpHost // 跳板机列表，将按顺序依次经由各个跳板机连接至目标，类似于 Open-SSH 的 ProxyJump
+
+	KeepAlive *KeepAliveConfig // 不为 nil 时，连接建立后将自动开始发送连接级别的 keepalive 请求
+
+	ControlPath string // master 的 control socket 路径，支持 %h、%p、%r；该路径上有 master 在运行时将经由其连接，否则正常建立连接
+
+	Observer Observer // 连接生命周期事件的观察者，为 nil 时不报告任何事件
+	Logger   Logger   // 库内部的日志输出，为 nil 时不输出任何日志
+
+	GlobalRequestHandlers map[string]GlobalRequestHandler // 连接建立时预先注册的全局请求处理函数，见 SSHClient.HandleGlobalRequest
+	ChannelHandlers       map[string]ChannelHandler       // 连接建立时预先注册的通道处理函数，见 SSHClient.HandleChannel
+
+	Metrics *MetricsRegistry // 不为 nil 时，连接的流量、通道以及身份认证失败次数将被计入该 registry
+
+	SendEnv []string // 打开 session 时发送的本地环境变量名称，支持 '*' 与 '?' 通配符，类似于 Open-SSH 的 SendEnv；服务端拒绝设置时将被忽略
 }
@@ -0,0 +1,249 @@
+package gossh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// hostRecorder 记录主机公钥验证时的主机名
+type hostRecorder struct {
+	mu    sync.Mutex
+	hosts []string
+}
+
+func (r *hostRecorder) check(hostname string, remote net.Addr, key PublicKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hosts = append(r.hosts, hostname)
+	return nil
+}
+
+func TestConnectThroughJumpHosts(t *testing.T) {
+	jump1, jump2, target := startTestServer(t), startTestServer(t), startTestServer(t)
+	recorder := &hostRecorder{}
+	config := testConfig(recorder.check)
+	config.JumpHosts = []*JumpHost{
+		{Addr: jump1.addr},
+		{Addr: jump2.addr, Config: testConfig(recorder.check)},
+	}
+	client, err := Connect(target.addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 每一跳都以其自身的地址进行主机公钥验证
+	recorder.mu.Lock()
+	hosts := append([]string(nil), recorder.hosts...)
+	recorder.mu.Unlock()
+	want := []string{jump1.addr, jump2.addr, target.addr}
+	if len(hosts) != len(want) {
+		t.Fatalf("host key checks = %v, want %v", hosts, want)
+	}
+	for i := range want {
+		if hosts[i] != want[i] {
+			t.Errorf("host key check %d for %s, want %s", i, hosts[i], want[i])
+		}
+	}
+
+	session, err := client.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := session.RunForOutput("through jump hosts")
+	if err != nil || string(output) != "through jump hosts" {
+		t.Fatalf("output = %q, err = %v", output, err)
+	}
+
+	// 关闭目标连接时一并关闭各个跳板机的连接
+	hop := client.parent
+	if hop == nil || hop.parent == nil {
+		t.Fatal("jump host connections not recorded")
+	}
+	client.Close()
+	for _, c := range []*SSHClient{hop, hop.parent} {
+		waitClientClosed(t, c)
+	}
+}
+
+func TestJumpHostClosedWhenTargetDrops(t *testing.T) {
+	jump := startTestServer(t)
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(newTestSigner(t))
+	conns := make(chan net.Conn, 1)
+	target := listenTestTCP(t, func(conn net.Conn) {
+		conns <- conn
+		serveTestConn(conn, serverConfig)
+	})
+
+	config := testConfig(IgnoreHostKey)
+	config.JumpHosts = []*JumpHost{{Addr: jump.addr}}
+	client, err := Connect(target, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hop := client.parent
+
+	// 目标断开连接后，跳板机的连接同样被关闭
+	(<-conns).Close()
+	waitClientClosed(t, client)
+	waitClientClosed(t, hop)
+}
+
+// waitClientClosed 等待 client 的连接被关闭
+func waitClientClosed(t *testing.T, client *SSHClient) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		client.c.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("connection to %s not closed", client.RemoteAddr())
+	}
+}
+
+func TestConnectJumpHostFailure(t *testing.T) {
+	target := startTestServer(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := listener.Addr().String()
+	listener.Close()
+
+	config := testConfig(IgnoreHostKey)
+	config.JumpHosts = []*JumpHost{{Addr: dead}}
+	if _, err := Connect(target.addr, config); err == nil {
+		t.Fatal("expected an error through an unreachable jump host")
+	}
+}
+
+// startSilentServer 接受连接但从不发送任何数据的服务端，用于测试握手超时
+func startSilentServer(t *testing.T) string {
+	return listenTestTCP(t, func(conn net.Conn) {
+		defer conn.Close()
+		io.Copy(ioutil.Discard, conn)
+	})
+}
+
+func TestConnectContextHandshakeTimeout(t *testing.T) {
+	addr := startSilentServer(t)
+	config := testConfig(IgnoreHostKey)
+	config.HandshakeTimeout = 100 * time.Millisecond
+	start := time.Now()
+	_, err := ConnectContext(context.Background(), addr, config)
+	if !errors.Is(err, ErrHandshake) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want a handshake deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("handshake aborted after %s", elapsed)
+	}
+}
+
+func TestConnectContextCanceled(t *testing.T) {
+	addr := startSilentServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := ConnectContext(ctx, addr, testConfig(IgnoreHostKey))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if IsTransient(err) {
+		t.Error("canceled connection reported as transient")
+	}
+}
+
+func TestConnectContextDialTimeout(t *testing.T) {
+	config := testConfig(IgnoreHostKey)
+	config.Timeout = 50 * time.Millisecond
+	config.Dialer = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	start := time.Now()
+	_, err := ConnectContext(context.Background(), "192.0.2.1:22", config)
+	var dialErr *DialError
+	if !errors.As(err, &dialErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want a dial deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("dial aborted after %s, want about %s", elapsed, config.Timeout)
+	}
+}
+
+func TestConfigDialer(t *testing.T) {
+	server := startTestServer(t)
+	recorder := &hostRecorder{}
+	config := testConfig(recorder.check)
+	var dialed string
+	config.Dialer = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = addr
+		var d net.Dialer
+		return d.DialContext(ctx, network, server.addr)
+	}
+	client, err := Connect("virtual.example.com:22", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if dialed != "virtual.example.com:22" {
+		t.Errorf("dialer called with %q", dialed)
+	}
+	// 主机公钥验证使用的是目标地址而不是实际连接的地址
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.hosts) != 1 || recorder.hosts[0] != "virtual.example.com:22" {
+		t.Errorf("host key checks = %v", recorder.hosts)
+	}
+}
+
+func TestNewClientFromConn(t *testing.T) {
+	server := startTestServer(t)
+	conn, err := net.Dial("tcp", server.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClientFromConn(conn, "named-host:22", testConfig(IgnoreHostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := client.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output, err := session.RunForOutput("over conn"); err != nil || string(output) != "over conn" {
+		t.Errorf("output = %q, err = %v", output, err)
+	}
+	client.Close()
+
+	if _, err := NewClientFromConn(nil, "named-host:22", testConfig(IgnoreHostKey)); err == nil {
+		t.Error("expected an error for a nil conn")
+	}
+
+	// 握手失败时 conn 将被关闭
+	local, remote := net.Pipe()
+	defer remote.Close()
+	go io.Copy(ioutil.Discard, remote)
+	go func() {
+		remote.Write([]byte("HTTP/1.1 400 Bad Request\r\n"))
+		remote.Close()
+	}()
+	config := testConfig(IgnoreHostKey)
+	config.HandshakeTimeout = time.Second
+	if _, err := NewClientFromConn(local, "named-host:22", config); err == nil {
+		t.Fatal("expected a handshake error")
+	}
+	if _, err := local.Write([]byte("x")); err == nil {
+		t.Error("conn not closed after a failed handshake")
+	}
+}
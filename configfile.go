@@ -0,0 +1,588 @@
+package gossh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// 本文件实现了以 YAML 或者 JSON 文件声明连接配置，例如：
+//
+//	address: web1.example.com:22
+//	user: deploy
+//	auth:
+//	  - type: private-key
+//	    path: ~/.ssh/id_ed25519
+//	    passphrase_env: DEPLOY_KEY_PASSPHRASE
+//	  - type: agent
+//	  - type: password
+//	    env: DEPLOY_PASSWORD
+//	known_hosts:
+//	  policy: strict
+//	  files: [~/.ssh/known_hosts]
+//	algorithms:
+//	  profile: modern
+//	timeout: 10s
+//	jump_hosts:
+//	  - address: bastion.example.com
+//	    user: ops
+//
+// JSON 是 YAML 的子集，使用相同的字段名称。跳板机中未给出的字段沿用顶层的配置
+
+// ConfigFileError 配置文件中的错误，Field 为出错字段的路径，例如 jump_hosts[0].auth[1].path
+type ConfigFileError struct {
+	File   string // 文件路径，从 io.Reader 解析时为空
+	Field  string // 出错的字段，文件本身格式错误时为空
+	Line   int    // 出错字段所在的行，从 1 开始，未知时为 0
+	Column int
+	Err    error
+}
+
+func (e *ConfigFileError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		b.WriteString(":")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "%d:%d:", e.Line, e.Column)
+	}
+	if b.Len() > 0 {
+		b.WriteString(" ")
+	}
+	if e.Field != "" {
+		b.WriteString(e.Field)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *ConfigFileError) Unwrap() error {
+	return e.Err
+}
+
+// 配置文件中 known_hosts.policy 的取值
+const (
+	KnownHostsStrict = "strict" // 只接受 known_hosts 中记录的主机公钥
+	KnownHostsAsk    = "ask"    // 遇到未知的主机公钥时在终端上询问
+	KnownHostsIgnore = "ignore" // 不验证主机公钥
+)
+
+// LoadConfigFile 加载 YAML 或者 JSON 格式的配置文件，返回 Config 以及目标地址（host:port），
+// 文件中的相对路径相对于配置文件所在的目录
+func LoadConfigFile(path string) (*Config, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	config, addr, err := ParseConfigFile(f, filepath.Dir(path))
+	var fileErr *ConfigFileError
+	if errors.As(err, &fileErr) {
+		fileErr.File = path
+	}
+	return config, addr, err
+}
+
+// ParseConfigFile 从 r 中解析 YAML 或者 JSON 格式的配置，dir 为解析相对路径时使用的目录，为空时使用当前目录。
+// 身份认证所需的私钥、环境变量以及 ssh-agent 在解析时即被读取，出错时返回 *ConfigFileError
+func ParseConfigFile(r io.Reader, dir string) (*Config, string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, "", &ConfigFileError{Err: err}
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, "", &ConfigFileError{Err: errors.New("empty config file")}
+	}
+	d := &configDecoder{dir: dir}
+	return d.host(doc.Content[0], "", nil)
+}
+
+// configDecoder 将 YAML 节点转换为 Config
+type configDecoder struct {
+	dir string
+}
+
+// fieldError 生成指向节点 n 的错误
+func fieldError(n *yaml.Node, field string, format string, args ...interface{}) error {
+	return &ConfigFileError{Field: field, Line: n.Line, Column: n.Column, Err: fmt.Errorf(format, args...)}
+}
+
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// mapping 依次以字段名称调用 fields 中对应的函数，存在未知或者重复的字段时返回错误
+func (d *configDecoder) mapping(n *yaml.Node, field string, fields map[string]func(v *yaml.Node, field string) error) error {
+	if n.Kind != yaml.MappingNode {
+		return fieldError(n, field, "expected a mapping")
+	}
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		name := joinField(field, key.Value)
+		fn, ok := fields[key.Value]
+		if !ok {
+			return fieldError(key, name, "unknown field")
+		}
+		if seen[key.Value] {
+			return fieldError(key, name, "duplicate field")
+		}
+		seen[key.Value] = true
+		if err := fn(value, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup 返回 mapping 节点中名称为 name 的值
+func lookup(n *yaml.Node, name string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == name {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func (d *configDecoder) str(n *yaml.Node, field string) (string, error) {
+	if n.Kind != yaml.ScalarNode {
+		return "", fieldError(n, field, "expected a string")
+	}
+	return n.Value, nil
+}
+
+func (d *configDecoder) boolean(n *yaml.Node, field string) (bool, error) {
+	var b bool
+	if n.Kind != yaml.ScalarNode || n.Decode(&b) != nil {
+		return false, fieldError(n, field, "expected true or false")
+	}
+	return b, nil
+}
+
+func (d *configDecoder) integer(n *yaml.Node, field string) (int, error) {
+	var i int
+	if n.Kind != yaml.ScalarNode || n.Decode(&i) != nil {
+		return 0, fieldError(n, field, "expected an integer")
+	}
+	return i, nil
+}
+
+// duration 解析形如 10s、1m30s 的时间长度
+func (d *configDecoder) duration(n *yaml.Node, field string) (time.Duration, error) {
+	if n.Kind != yaml.ScalarNode {
+		return 0, fieldError(n, field, "expected a duration like 10s")
+	}
+	v, err := time.ParseDuration(n.Value)
+	if err != nil || v < 0 {
+		return 0, fieldError(n, field, "invalid duration '%s', expected a duration like 10s", n.Value)
+	}
+	return v, nil
+}
+
+// sequence 对列表中的每一项调用 fn，单个值视为只有一项的列表
+func (d *configDecoder) sequence(n *yaml.Node, field string, fn func(v *yaml.Node, field string) error) error {
+	if n.Kind != yaml.SequenceNode {
+		return fn(n, field)
+	}
+	for i, item := range n.Content {
+		if err := fn(item, fmt.Sprintf("%s[%d]", field, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *configDecoder) strings(n *yaml.Node, field string) ([]string, error) {
+	list := []string{}
+	err := d.sequence(n, field, func(v *yaml.Node, field string) error {
+		s, err := d.str(v, field)
+		list = append(list, s)
+		return err
+	})
+	return list, err
+}
+
+// path 解析文件路径，支持 '~'，相对路径相对于配置文件所在的目录
+func (d *configDecoder) path(n *yaml.Node, field string) (string, error) {
+	s, err := d.str(n, field)
+	if err != nil {
+		return "", err
+	}
+	if s == "" {
+		return "", fieldError(n, field, "empty path")
+	}
+	s = expandHome(s)
+	if !filepath.IsAbs(s) && d.dir != "" {
+		s = filepath.Join(d.dir, s)
+	}
+	return s, nil
+}
+
+// address 解析 host 或者 host:port，未给出端口时使用 22
+func (d *configDecoder) address(n *yaml.Node, field string) (string, error) {
+	s, err := d.str(n, field)
+	if err != nil {
+		return "", err
+	}
+	if s == "" {
+		return "", fieldError(n, field, "empty address")
+	}
+	if _, _, err := net.SplitHostPort(s); err == nil {
+		return s, nil
+	}
+	return net.JoinHostPort(strings.Trim(s, "[]"), "22"), nil
+}
+
+// host 解析一个主机的配置，inherit 不为 nil 时（跳板机）未给出的字段沿用 inherit 中的值
+func (d *configDecoder) host(n *yaml.Node, field string, inherit *Config) (*Config, string, error) {
+	config := &Config{}
+	if inherit != nil {
+		*config = *inherit
+		config.JumpHosts = nil
+	}
+	var addr string
+	var knownHostsSet bool
+
+	fields := map[string]func(v *yaml.Node, field string) error{
+		"address": func(v *yaml.Node, field string) (err error) {
+			addr, err = d.address(v, field)
+			return err
+		},
+		"user": func(v *yaml.Node, field string) (err error) {
+			config.User, err = d.str(v, field)
+			return err
+		},
+		"auth": func(v *yaml.Node, field string) (err error) {
+			config.Auth, err = d.auth(v, field)
+			return err
+		},
+		"known_hosts": func(v *yaml.Node, field string) error {
+			knownHostsSet = true
+			return d.knownHosts(v, field, config)
+		},
+		"algorithms": func(v *yaml.Node, field string) error {
+			return d.algorithms(v, field, config)
+		},
+		"timeout": func(v *yaml.Node, field string) (err error) {
+			config.Timeout, err = d.duration(v, field)
+			return err
+		},
+		"handshake_timeout": func(v *yaml.Node, field string) (err error) {
+			config.HandshakeTimeout, err = d.duration(v, field)
+			return err
+		},
+		"client_version": func(v *yaml.Node, field string) (err error) {
+			config.ClientVersion, err = d.str(v, field)
+			return err
+		},
+	}
+	if inherit == nil {
+		// 以下字段只对目标主机有效
+		fields["keepalive"] = func(v *yaml.Node, field string) (err error) {
+			config.KeepAlive, err = d.keepAlive(v, field)
+			return err
+		}
+		fields["proxy"] = func(v *yaml.Node, field string) error {
+			s, err := d.str(v, field)
+			if err != nil {
+				return err
+			}
+			if config.Proxy, err = ParseProxyURL(s); err != nil {
+				return fieldError(v, field, "%v", err)
+			}
+			return nil
+		}
+		fields["proxy_command"] = func(v *yaml.Node, field string) (err error) {
+			config.ProxyCommand, err = d.str(v, field)
+			return err
+		}
+		fields["control_path"] = func(v *yaml.Node, field string) (err error) {
+			config.ControlPath, err = d.str(v, field)
+			return err
+		}
+		fields["send_env"] = func(v *yaml.Node, field string) (err error) {
+			config.SendEnv, err = d.strings(v, field)
+			return err
+		}
+		fields["jump_hosts"] = func(v *yaml.Node, field string) error {
+			// 在顶层的其余字段处理完成后解析
+			return nil
+		}
+	}
+
+	if err := d.mapping(n, field, fields); err != nil {
+		return nil, "", err
+	}
+	if addr == "" {
+		return nil, "", fieldError(n, joinField(field, "address"), "missing required field")
+	}
+	if inherit == nil && !knownHostsSet {
+		if err := d.knownHosts(&yaml.Node{Kind: yaml.MappingNode}, joinField(field, "known_hosts"), config); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if jumps := lookup(n, "jump_hosts"); inherit == nil && jumps != nil {
+		base := *config
+		base.KeepAlive, base.Proxy, base.ProxyCommand, base.ControlPath, base.SendEnv = nil, nil, "", "", nil
+		err := d.sequence(jumps, "jump_hosts", func(v *yaml.Node, field string) error {
+			jumpConfig, jumpAddr, err := d.host(v, field, &base)
+			if err != nil {
+				return err
+			}
+			config.JumpHosts = append(config.JumpHosts, &JumpHost{Addr: jumpAddr, Config: jumpConfig})
+			return nil
+		})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return config, addr, nil
+}
+
+// auth 解析身份认证方法列表，每一项以 type 指定类型：private-key、agent 或者 password
+func (d *configDecoder) auth(n *yaml.Node, field string) ([]AuthMethod, error) {
+	if n.Kind != yaml.SequenceNode {
+		return nil, fieldError(n, field, "expected a list of auth methods")
+	}
+	var methods []AuthMethod
+	for i, item := range n.Content {
+		itemField := fmt.Sprintf("%s[%d]", field, i)
+		var method AuthMethod
+		var err error
+
+		typeNode := lookup(item, "type")
+		if typeNode == nil {
+			return nil, fieldError(item, joinField(itemField, "type"), "missing required field, expected private-key, agent or password")
+		}
+		typeOnly := func(v *yaml.Node, field string) error { return nil }
+
+		switch typeNode.Value {
+		case "private-key":
+			var paths []string
+			var pathNode *yaml.Node
+			var provider PassphraseProvider
+			err = d.mapping(item, itemField, map[string]func(v *yaml.Node, field string) error{
+				"type": typeOnly,
+				"path": func(v *yaml.Node, field string) error {
+					pathNode = v
+					return d.sequence(v, field, func(v *yaml.Node, field string) error {
+						path, err := d.path(v, field)
+						paths = append(paths, path)
+						return err
+					})
+				},
+				"passphrase_env": func(v *yaml.Node, field string) error {
+					env, err := d.str(v, field)
+					provider = PassphraseFromEnv(env)
+					return err
+				},
+				"passphrase_file": func(v *yaml.Node, field string) error {
+					path, err := d.path(v, field)
+					provider = PassphraseFromFile(path)
+					return err
+				},
+			})
+			if err == nil && len(paths) == 0 {
+				err = fieldError(item, joinField(itemField, "path"), "missing required field")
+			}
+			if err == nil && lookup(item, "passphrase_env") != nil && lookup(item, "passphrase_file") != nil {
+				err = fieldError(lookup(item, "passphrase_file"), joinField(itemField, "passphrase_file"), "conflicts with passphrase_env")
+			}
+			if err == nil {
+				if method, err = AuthByPrivateKeysFromPathsWithPassphrase(provider, paths...); err != nil {
+					err = fieldError(pathNode, joinField(itemField, "path"), "%v", err)
+				}
+			}
+		case "agent":
+			err = d.mapping(item, itemField, map[string]func(v *yaml.Node, field string) error{"type": typeOnly})
+			if err == nil {
+				if method, err = SSHAgentAuth(); err != nil {
+					err = fieldError(typeNode, joinField(itemField, "type"), "connect to ssh-agent: %v", err)
+				}
+			}
+		case "password":
+			var env string
+			var envNode *yaml.Node
+			err = d.mapping(item, itemField, map[string]func(v *yaml.Node, field string) error{
+				"type": typeOnly,
+				"env": func(v *yaml.Node, field string) (err error) {
+					envNode = v
+					env, err = d.str(v, field)
+					return err
+				},
+			})
+			if err == nil && envNode == nil {
+				err = fieldError(item, joinField(itemField, "env"), "missing required field")
+			}
+			if err == nil {
+				password, ok := os.LookupEnv(env)
+				if !ok {
+					err = fieldError(envNode, joinField(itemField, "env"), "environment variable %s is not set", env)
+				}
+				method = PasswordAuth(password)
+			}
+		default:
+			err = fieldError(typeNode, joinField(itemField, "type"), "unknown auth type '%s', expected private-key, agent or password", typeNode.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, method)
+	}
+	return methods, nil
+}
+
+// knownHosts 解析主机公钥验证方式，policy 默认为 strict，files 默认为 ~/.ssh/known_hosts，
+// cert_authorities 为受信任的主机证书 CA 公钥文件
+func (d *configDecoder) knownHosts(n *yaml.Node, field string, config *Config) error {
+	policy := KnownHostsStrict
+	var files []string
+	var updateHostKeys bool
+	var authorities []ssh.PublicKey
+	err := d.mapping(n, field, map[string]func(v *yaml.Node, field string) error{
+		"policy": func(v *yaml.Node, field string) (err error) {
+			if policy, err = d.str(v, field); err != nil {
+				return err
+			}
+			switch policy {
+			case KnownHostsStrict, KnownHostsAsk, KnownHostsIgnore:
+				return nil
+			}
+			return fieldError(v, field, "unknown policy '%s', expected strict, ask or ignore", policy)
+		},
+		"files": func(v *yaml.Node, field string) error {
+			return d.sequence(v, field, func(v *yaml.Node, field string) error {
+				path, err := d.path(v, field)
+				files = append(files, path)
+				return err
+			})
+		},
+		"update_host_keys": func(v *yaml.Node, field string) (err error) {
+			updateHostKeys, err = d.boolean(v, field)
+			return err
+		},
+		"cert_authorities": func(v *yaml.Node, field string) error {
+			return d.sequence(v, field, func(v *yaml.Node, field string) error {
+				path, err := d.path(v, field)
+				if err != nil {
+					return err
+				}
+				keys, err := LoadCertAuthorities(path)
+				if err != nil {
+					return fieldError(v, field, "%v", err)
+				}
+				authorities = append(authorities, keys...)
+				return nil
+			})
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	config.GlobalRequestHandlers = nil
+	if policy == KnownHostsIgnore {
+		config.HostKeyCallback = IgnoreHostKey
+		return nil
+	}
+	if len(files) == 0 {
+		files = []string{expandHome("~/" + OpenSSHKnownHostsPath)}
+	}
+	checker := NewKnownHostsChecker(policy == KnownHostsAsk, files...)
+	checker.Authorities = authorities
+	config.HostKeyCallback = checker.KnownHostsCheck
+	if updateHostKeys {
+		config.GlobalRequestHandlers = map[string]GlobalRequestHandler{HostKeysRequest: checker.UpdateHostKeys}
+	}
+	return nil
+}
+
+// algorithms 解析算法配置：先应用 profile，再以显式给出的列表覆盖
+func (d *configDecoder) algorithms(n *yaml.Node, field string, config *Config) error {
+	list := func(target *[]string, supported []string) func(v *yaml.Node, field string) error {
+		return func(v *yaml.Node, field string) error {
+			algos := []string{}
+			err := d.sequence(v, field, func(v *yaml.Node, field string) error {
+				algo, err := d.str(v, field)
+				if err != nil {
+					return err
+				}
+				if !containsString(supported, algo) {
+					return fieldError(v, field, "unsupported algorithm '%s' (supported: %s)", algo, strings.Join(supported, ", "))
+				}
+				algos = append(algos, algo)
+				return nil
+			})
+			if err == nil && len(algos) == 0 {
+				err = fieldError(v, field, "empty algorithm list")
+			}
+			*target = algos
+			return err
+		}
+	}
+
+	if v := lookup(n, "profile"); v != nil {
+		name, err := d.str(v, joinField(field, "profile"))
+		if err != nil {
+			return err
+		}
+		profile, ok := LookupAlgorithmProfile(name)
+		if !ok {
+			return fieldError(v, joinField(field, "profile"), "unknown profile '%s', expected %s", name, strings.Join(AlgorithmProfileNames(), ", "))
+		}
+		profile.Apply(config)
+	}
+	return d.mapping(n, field, map[string]func(v *yaml.Node, field string) error{
+		"profile":             func(v *yaml.Node, field string) error { return nil },
+		"key_exchanges":       list(&config.KeyExchanges, supportedKeyExchanges),
+		"ciphers":             list(&config.Ciphers, supportedCiphers),
+		"macs":                list(&config.MACs, supportedMACs),
+		"host_key_algorithms": list(&config.HostKeyAlgorithms, supportedHostKeyAlgorithms),
+	})
+}
+
+// keepAlive 解析 keepalive 配置
+func (d *configDecoder) keepAlive(n *yaml.Node, field string) (*KeepAliveConfig, error) {
+	keepAlive := &KeepAliveConfig{}
+	err := d.mapping(n, field, map[string]func(v *yaml.Node, field string) error{
+		"interval": func(v *yaml.Node, field string) (err error) {
+			keepAlive.Interval, err = d.duration(v, field)
+			return err
+		},
+		"timeout": func(v *yaml.Node, field string) (err error) {
+			keepAlive.Timeout, err = d.duration(v, field)
+			return err
+		},
+		"max_missed": func(v *yaml.Node, field string) (err error) {
+			keepAlive.MaxMissed, err = d.integer(v, field)
+			return err
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keepAlive, nil
+}
@@ -0,0 +1,196 @@
+package gossh
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// setTestEnv 设置环境变量，并在测试结束时恢复
+func setTestEnv(t *testing.T, key, value string) {
+	t.Helper()
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func writeConfigFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFileYAML(t *testing.T) {
+	server := startTestServer(t)
+	dir := t.TempDir()
+	key, _ := newTestPrivateKey(t)
+	writeConfigFile(t, dir, "id_plain", string(key))
+	key, _ = newTestPrivateKey(t)
+	writeConfigFile(t, dir, "id_encrypted", string(encryptTestKey(t, key, "pass")))
+	writeKnownHostsIn(t, dir, "known_hosts", server)
+	setTestEnv(t, "GOSSH_TEST_PASSWORD", testPassword)
+	setTestEnv(t, "GOSSH_TEST_PASSPHRASE", "pass")
+
+	path := writeConfigFile(t, dir, "config.yaml", fmt.Sprintf(`
+address: %s
+user: tester
+auth:
+  - type: private-key
+    path: [id_plain, id_encrypted]
+    passphrase_env: GOSSH_TEST_PASSPHRASE
+  - type: password
+    env: GOSSH_TEST_PASSWORD
+known_hosts:
+  files: known_hosts
+algorithms:
+  profile: modern
+  ciphers: aes256-ctr
+timeout: 5s
+keepalive:
+  interval: 30s
+  max_missed: 3
+send_env: [LANG, LC_*]
+`, server.addr))
+	config, addr, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != server.addr || config.User != "tester" || config.Timeout != 5*time.Second {
+		t.Errorf("addr = %q, user = %q, timeout = %s", addr, config.User, config.Timeout)
+	}
+	if len(config.Auth) != 2 {
+		t.Errorf("got %d auth methods, want 2", len(config.Auth))
+	}
+	if len(config.Ciphers) != 1 || config.Ciphers[0] != "aes256-ctr" || len(config.MACs) == 0 {
+		t.Errorf("ciphers = %q, macs = %q", config.Ciphers, config.MACs)
+	}
+	if config.KeepAlive == nil || config.KeepAlive.Interval != 30*time.Second || config.KeepAlive.MaxMissed != 3 {
+		t.Errorf("keepalive = %+v", config.KeepAlive)
+	}
+	if strings.Join(config.SendEnv, " ") != "LANG LC_*" {
+		t.Errorf("send_env = %q", config.SendEnv)
+	}
+
+	// 相对路径的 known_hosts 相对于配置文件所在的目录
+	client, err := Connect(addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+}
+
+// writeKnownHostsIn 在 dir 中写入记录了 server 主机公钥的 known_hosts 文件
+func writeKnownHostsIn(t *testing.T, dir, name string, server *testServer) {
+	t.Helper()
+	line := fmt.Sprintf("%s %s\n", knownhosts.Normalize(server.addr), authorizedKey(server.hostKey.PublicKey()))
+	writeConfigFile(t, dir, name, line)
+}
+
+func TestParseConfigFileJSONWithJumpHosts(t *testing.T) {
+	jump, target := startTestServer(t), startTestServer(t)
+	setTestEnv(t, "GOSSH_TEST_PASSWORD", testPassword)
+	config, addr, err := ParseConfigFile(strings.NewReader(fmt.Sprintf(`{
+	"address": %q,
+	"user": "tester",
+	"auth": [{"type": "password", "env": "GOSSH_TEST_PASSWORD"}],
+	"known_hosts": {"policy": "ignore"},
+	"jump_hosts": [{"address": %q, "timeout": "3s"}]
+}`, target.addr, jump.addr)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != target.addr || len(config.JumpHosts) != 1 {
+		t.Fatalf("addr = %q, jump hosts = %d", addr, len(config.JumpHosts))
+	}
+	// 跳板机沿用顶层的用户以及认证方法
+	jumpConfig := config.JumpHosts[0].Config
+	if jumpConfig.User != "tester" || len(jumpConfig.Auth) != 1 || jumpConfig.Timeout != 3*time.Second || len(jumpConfig.JumpHosts) != 0 {
+		t.Errorf("jump host config = %+v", jumpConfig)
+	}
+	client, err := Connect(addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+}
+
+func TestParseConfigFileAddressDefaultPort(t *testing.T) {
+	for in, want := range map[string]string{
+		"example.com":      "example.com:22",
+		"example.com:2222": "example.com:2222",
+		"[::1]":            "[::1]:22",
+	} {
+		_, addr, err := ParseConfigFile(strings.NewReader(fmt.Sprintf("address: %q\nknown_hosts: {policy: ignore}\n", in)), "")
+		if err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if addr != want {
+			t.Errorf("address %q = %q, want %q", in, addr, want)
+		}
+	}
+}
+
+func TestParseConfigFileErrors(t *testing.T) {
+	setTestEnv(t, "GOSSH_TEST_PASSWORD", testPassword)
+	os.Unsetenv("GOSSH_TEST_UNSET")
+	tests := []struct {
+		content string
+		field   string
+		line    int
+		wantErr string
+	}{
+		{content: "user: tester\n", field: "address", line: 1, wantErr: "missing required field"},
+		{content: "address: h\nport: 22\n", field: "port", line: 2, wantErr: "unknown field"},
+		{content: "address: h\naddress: g\n", field: "address", line: 2, wantErr: "duplicate field"},
+		{content: "address: h\ntimeout: 10\n", field: "timeout", line: 2, wantErr: "invalid duration"},
+		{content: "address: h\nknown_hosts:\n  policy: trust\n", field: "known_hosts.policy", line: 3, wantErr: "unknown policy"},
+		{content: "address: h\nalgorithms:\n  profile: fast\n", field: "algorithms.profile", line: 3, wantErr: "unknown profile"},
+		{content: "address: h\nalgorithms:\n  ciphers: [aes128-ctr, rot13]\n", field: "algorithms.ciphers[1]", line: 3, wantErr: "unsupported algorithm 'rot13'"},
+		{content: "address: h\nauth:\n  - type: password\n", field: "auth[0].env", line: 3, wantErr: "missing required field"},
+		{content: "address: h\nauth:\n  - type: password\n    env: GOSSH_TEST_UNSET\n", field: "auth[0].env", line: 4, wantErr: "is not set"},
+		{content: "address: h\nauth:\n  - type: otp\n", field: "auth[0].type", line: 3, wantErr: "unknown auth type"},
+		{content: "address: h\nauth:\n  - type: private-key\n    path: missing_key\n", field: "auth[0].path", line: 4, wantErr: "missing_key"},
+		{content: "address: h\nauth:\n  - type: private-key\n    path: k\n    passphrase_env: P\n    passphrase_file: p\n", field: "auth[0].passphrase_file", line: 6, wantErr: "conflicts with passphrase_env"},
+		{content: "address: h\njump_hosts:\n  - user: ops\n", field: "jump_hosts[0].address", line: 3, wantErr: "missing required field"},
+		{content: "address: h\njump_hosts:\n  - address: j\n    proxy: socks5://p\n", field: "jump_hosts[0].proxy", line: 4, wantErr: "unknown field"},
+		{content: "address: h\nkeepalive: {max_missed: many}\n", field: "keepalive.max_missed", line: 2, wantErr: "expected an integer"},
+	}
+	dir := t.TempDir()
+	for i, tt := range tests {
+		path := writeConfigFile(t, dir, fmt.Sprintf("config%d.yaml", i), tt.content)
+		_, _, err := LoadConfigFile(path)
+		var fileErr *ConfigFileError
+		if !errors.As(err, &fileErr) {
+			t.Errorf("%q: err = %v, want a *ConfigFileError", tt.content, err)
+			continue
+		}
+		if fileErr.File != path || fileErr.Field != tt.field || fileErr.Line != tt.line || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%q: got %s (field %q, line %d), want field %q, line %d, %q",
+				tt.content, err, fileErr.Field, fileErr.Line, tt.field, tt.line, tt.wantErr)
+		}
+	}
+
+	if _, _, err := ParseConfigFile(strings.NewReader("address: [h\n"), ""); err == nil {
+		t.Error("expected an error for malformed YAML")
+	}
+	if _, _, err := ParseConfigFile(strings.NewReader(""), ""); err == nil {
+		t.Error("expected an error for an empty file")
+	}
+}
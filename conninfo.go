@@ -0,0 +1,282 @@
+package gossh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 本文件实现了握手结果的记录。ssh 包不提供协商得到的算法，
+// 因此在传输层上截取双方首次发送的明文 SSH_MSG_KEXINIT，并按照 RFC 4253 7.1 节的规则计算协商结果
+
+// ConnectionInfo 连接的协商结果，算法字段为首次密钥交换时协商得到的算法，无法获取时为空
+type ConnectionInfo struct {
+	User          string
+	LocalAddr     net.Addr
+	RemoteAddr    net.Addr
+	ClientVersion string
+	ServerVersion string
+	SessionID     []byte
+
+	KeyExchange               string // 密钥交换算法
+	HostKeyAlgorithm          string // 主机公钥签名算法，例如 rsa-sha2-512
+	CipherClientToServer      string
+	CipherServerToClient      string
+	MACClientToServer         string // 使用 AEAD 加密算法时为空
+	MACServerToClient         string // 使用 AEAD 加密算法时为空
+	CompressionClientToServer string
+	CompressionServerToClient string
+
+	HostKey            PublicKey // 握手时通过验证的服务端主机公钥
+	HostKeyType        string
+	HostKeyFingerprint string // SHA256 指纹，格式与 ssh-keygen -l 相同
+}
+
+// ConnectionInfo 返回连接的版本、协商得到的算法以及服务端主机公钥等信息
+func (client *SSHClient) ConnectionInfo() ConnectionInfo {
+	info := ConnectionInfo{
+		User:          client.User(),
+		LocalAddr:     client.LocalAddr(),
+		RemoteAddr:    client.RemoteAddr(),
+		ClientVersion: string(client.ClientVersion()),
+		ServerVersion: string(client.ServerVersion()),
+		SessionID:     client.SessionID(),
+		HostKey:       client.hostKey,
+	}
+	if client.hostKey != nil {
+		info.HostKeyType = client.hostKey.Type()
+		info.HostKeyFingerprint = ssh.FingerprintSHA256(client.hostKey)
+	}
+	if client.kexSniffer != nil {
+		client.kexSniffer.negotiate(&info)
+	}
+	return info
+}
+
+const (
+	msgKexInit        = 20
+	maxKexInitSniffed = 256 * 1024 // 截取 KEXINIT 时最多缓存的字节数
+)
+
+// kexInit SSH_MSG_KEXINIT 中的算法列表
+type kexInit struct {
+	Cookie                  [16]byte
+	KexAlgos                []string
+	ServerHostKeyAlgos      []string
+	CiphersClientServer     []string
+	CiphersServerClient     []string
+	MACsClientServer        []string
+	MACsServerClient        []string
+	CompressionClientServer []string
+	CompressionServerClient []string
+	LanguagesClientServer   []string
+	LanguagesServerClient   []string
+	FirstKexFollows         bool
+	Reserved                uint32
+}
+
+// kexSniffer 截取双方发送的第一个 KEXINIT
+type kexSniffer struct {
+	net.Conn
+
+	mu     sync.Mutex
+	client streamSniffer // 本端写出的数据
+	server streamSniffer // 本端读取的数据
+	ioErr  error         // 第一次读写失败的错误，不含关闭连接后的读写
+}
+
+// streamSniffer 在单个方向的字节流上查找第一个 KEXINIT
+type streamSniffer struct {
+	buf     []byte
+	done    bool
+	kexInit *kexInit
+}
+
+func newKexSniffer(conn net.Conn) *kexSniffer {
+	return &kexSniffer{Conn: conn}
+}
+
+func (s *kexSniffer) Read(b []byte) (int, error) {
+	n, err := s.Conn.Read(b)
+	if n > 0 {
+		s.mu.Lock()
+		s.server.feed(b[:n])
+		s.mu.Unlock()
+	}
+	if err != nil {
+		s.fail(err)
+	}
+	return n, err
+}
+
+func (s *kexSniffer) Write(b []byte) (int, error) {
+	n, err := s.Conn.Write(b)
+	if n > 0 {
+		s.mu.Lock()
+		s.client.feed(b[:n])
+		s.mu.Unlock()
+	}
+	if err != nil {
+		s.fail(err)
+	}
+	return n, err
+}
+
+// fail 记录读写错误，ssh 包在握手失败后关闭连接导致的错误除外
+func (s *kexSniffer) fail(err error) {
+	if errors.Is(err, net.ErrClosed) {
+		return
+	}
+	s.mu.Lock()
+	if s.ioErr == nil {
+		s.ioErr = err
+	}
+	s.mu.Unlock()
+}
+
+// ioError 第一次读写失败的错误
+func (s *kexSniffer) ioError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ioErr
+}
+
+// feed 追加数据，并尝试解析：跳过版本行（以及服务端在版本行之前发送的其他行）后，第一个二进制包即为 KEXINIT
+func (s *streamSniffer) feed(data []byte) {
+	if s.done {
+		return
+	}
+	s.buf = append(s.buf, data...)
+	if len(s.buf) > maxKexInitSniffed {
+		s.done, s.buf = true, nil
+		return
+	}
+
+	buf := s.buf
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			return
+		}
+		line := buf[:i+1]
+		buf = buf[i+1:]
+		if bytes.HasPrefix(line, []byte("SSH-")) {
+			break
+		}
+	}
+	if len(buf) < 5 {
+		return
+	}
+	length := binary.BigEndian.Uint32(buf)
+	if uint64(len(buf)) < 4+uint64(length) {
+		return
+	}
+	packet := buf[4 : 4+length]
+	s.done, s.buf = true, nil
+	if len(packet) == 0 {
+		return
+	}
+
+	padding := int(packet[0])
+	if len(packet) < 1+padding+1 {
+		return
+	}
+	payload := packet[1 : len(packet)-padding]
+	if payload[0] != msgKexInit {
+		return
+	}
+	msg := new(kexInit)
+	if err := ssh.Unmarshal(payload[1:], msg); err != nil {
+		return
+	}
+	s.kexInit = msg
+}
+
+// negotiate 根据双方的 KEXINIT 计算协商得到的算法
+func (s *kexSniffer) negotiate(info *ConnectionInfo) {
+	s.mu.Lock()
+	client, server := s.client.kexInit, s.server.kexInit
+	s.mu.Unlock()
+	if client == nil || server == nil {
+		return
+	}
+
+	info.KeyExchange = findCommonAlgorithm(client.KexAlgos, server.KexAlgos)
+	info.HostKeyAlgorithm = findCommonAlgorithm(client.ServerHostKeyAlgos, server.ServerHostKeyAlgos)
+	info.CipherClientToServer = findCommonAlgorithm(client.CiphersClientServer, server.CiphersClientServer)
+	info.CipherServerToClient = findCommonAlgorithm(client.CiphersServerClient, server.CiphersServerClient)
+	if !isAEADCipher(info.CipherClientToServer) {
+		info.MACClientToServer = findCommonAlgorithm(client.MACsClientServer, server.MACsClientServer)
+	}
+	if !isAEADCipher(info.CipherServerToClient) {
+		info.MACServerToClient = findCommonAlgorithm(client.MACsServerClient, server.MACsServerClient)
+	}
+	info.CompressionClientToServer = findCommonAlgorithm(client.CompressionClientServer, server.CompressionClientServer)
+	info.CompressionServerToClient = findCommonAlgorithm(client.CompressionServerClient, server.CompressionServerClient)
+}
+
+// mismatch 根据双方的 KEXINIT 找出第一类没有共同算法的协商对象，双方的 KEXINIT 不全或者每一类都有共同算法时返回 nil
+func (s *kexSniffer) mismatch() *AlgorithmError {
+	s.mu.Lock()
+	client, server := s.client.kexInit, s.server.kexInit
+	s.mu.Unlock()
+	if client == nil || server == nil {
+		return nil
+	}
+
+	categories := []struct {
+		what           string
+		client, server []string
+	}{
+		{"key exchange", client.KexAlgos, server.KexAlgos},
+		{"host key", client.ServerHostKeyAlgos, server.ServerHostKeyAlgos},
+		{"client to server cipher", client.CiphersClientServer, server.CiphersClientServer},
+		{"server to client cipher", client.CiphersServerClient, server.CiphersServerClient},
+		{"client to server MAC", client.MACsClientServer, server.MACsClientServer},
+		{"server to client MAC", client.MACsServerClient, server.MACsServerClient},
+		{"client to server compression", client.CompressionClientServer, server.CompressionClientServer},
+		{"server to client compression", client.CompressionServerClient, server.CompressionServerClient},
+	}
+	for _, category := range categories {
+		if findCommonAlgorithm(category.client, category.server) != "" {
+			continue
+		}
+		switch category.what {
+		case "client to server MAC":
+			if isAEADCipher(findCommonAlgorithm(client.CiphersClientServer, server.CiphersClientServer)) {
+				continue
+			}
+		case "server to client MAC":
+			if isAEADCipher(findCommonAlgorithm(client.CiphersServerClient, server.CiphersServerClient)) {
+				continue
+			}
+		}
+		return &AlgorithmError{What: category.what, Client: category.client, Server: category.server}
+	}
+	return nil
+}
+
+// findCommonAlgorithm 返回客户端列表中第一个服务端同样支持的算法
+func findCommonAlgorithm(client, server []string) string {
+	for _, c := range client {
+		for _, s := range server {
+			if c == s {
+				return c
+			}
+		}
+	}
+	return ""
+}
+
+// isAEADCipher 判断加密算法是否自带消息认证，此时不协商 MAC 算法
+func isAEADCipher(cipher string) bool {
+	switch cipher {
+	case "aes128-gcm@openssh.com", "aes256-gcm@openssh.com", "chacha20-poly1305@openssh.com":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package gossh
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestConnectionInfo(t *testing.T) {
+	server := startTestServer(t)
+	config := testConfig(IgnoreHostKey)
+	config.KeyExchanges = []string{"curve25519-sha256@libssh.org"}
+	config.Ciphers = []string{"aes128-ctr"}
+	config.MACs = []string{"hmac-sha2-256"}
+	client, err := Connect(server.addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	info := client.ConnectionInfo()
+	want := map[string]string{
+		"User":                 "tester",
+		"KeyExchange":          "curve25519-sha256@libssh.org",
+		"HostKeyAlgorithm":     ssh.KeyAlgoED25519,
+		"CipherClientToServer": "aes128-ctr",
+		"CipherServerToClient": "aes128-ctr",
+		"MACClientToServer":    "hmac-sha2-256",
+		"MACServerToClient":    "hmac-sha2-256",
+		"Compression":          "none",
+		"HostKeyType":          ssh.KeyAlgoED25519,
+		"HostKeyFingerprint":   ssh.FingerprintSHA256(server.hostKey.PublicKey()),
+	}
+	got := map[string]string{
+		"User":                 info.User,
+		"KeyExchange":          info.KeyExchange,
+		"HostKeyAlgorithm":     info.HostKeyAlgorithm,
+		"CipherClientToServer": info.CipherClientToServer,
+		"CipherServerToClient": info.CipherServerToClient,
+		"MACClientToServer":    info.MACClientToServer,
+		"MACServerToClient":    info.MACServerToClient,
+		"Compression":          info.CompressionClientToServer,
+		"HostKeyType":          info.HostKeyType,
+		"HostKeyFingerprint":   info.HostKeyFingerprint,
+	}
+	for field, w := range want {
+		if got[field] != w {
+			t.Errorf("%s = %q, want %q", field, got[field], w)
+		}
+	}
+	if len(info.SessionID) == 0 || info.ServerVersion == "" || info.RemoteAddr.String() != server.addr {
+		t.Errorf("incomplete connection info: %+v", info)
+	}
+}
+
+func TestConnectionInfoAEADCipher(t *testing.T) {
+	server := startTestServer(t)
+	config := testConfig(IgnoreHostKey)
+	config.Ciphers = []string{"chacha20-poly1305@openssh.com"}
+	client, err := Connect(server.addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// AEAD 加密算法不协商 MAC 算法
+	info := client.ConnectionInfo()
+	if info.CipherClientToServer != "chacha20-poly1305@openssh.com" || info.MACClientToServer != "" || info.MACServerToClient != "" {
+		t.Errorf("cipher = %q, macs = %q %q", info.CipherClientToServer, info.MACClientToServer, info.MACServerToClient)
+	}
+}
+
+func TestStreamSnifferSplitPackets(t *testing.T) {
+	msg := kexInit{
+		KexAlgos:                []string{"kex"},
+		ServerHostKeyAlgos:      []string{"hostkey"},
+		CiphersClientServer:     []string{"cipher"},
+		CiphersServerClient:     []string{"cipher"},
+		MACsClientServer:        []string{"mac"},
+		MACsServerClient:        []string{"mac"},
+		CompressionClientServer: []string{"none"},
+		CompressionServerClient: []string{"none"},
+	}
+	payload := append([]byte{msgKexInit}, ssh.Marshal(&msg)...)
+	const padding = 4
+	packet := append([]byte{padding}, payload...)
+	packet = append(packet, make([]byte, padding)...)
+	length := len(packet)
+	stream := []byte("banner line\r\nSSH-2.0-Test\r\n")
+	stream = append(stream, byte(length>>24), byte(length>>16), byte(length>>8), byte(length))
+	stream = append(stream, packet...)
+
+	// 逐字节输入，模拟数据被拆分为多次读取
+	var s streamSniffer
+	for i := range stream {
+		s.feed(stream[i : i+1])
+	}
+	if s.kexInit == nil || s.kexInit.KexAlgos[0] != "kex" || s.kexInit.MACsServerClient[0] != "mac" {
+		t.Fatalf("kexinit = %+v", s.kexInit)
+	}
+}
+
+func TestFindCommonAlgorithm(t *testing.T) {
+	tests := []struct {
+		client, server []string
+		want           string
+	}{
+		{client: []string{"a", "b"}, server: []string{"b", "a"}, want: "a"},
+		{client: []string{"c", "b"}, server: []string{"a", "b"}, want: "b"},
+		{client: []string{"c"}, server: []string{"a"}, want: ""},
+		{client: nil, server: []string{"a"}, want: ""},
+	}
+	for _, tt := range tests {
+		if got := findCommonAlgorithm(tt.client, tt.server); got != tt.want {
+			t.Errorf("findCommonAlgorithm(%q, %q) = %q, want %q", tt.client, tt.server, got, tt.want)
+		}
+	}
+}
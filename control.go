@@ -0,0 +1,328 @@
+package gossh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 本文件实现了类似于 Open-SSH ControlMaster 的连接复用：
+// master 保持一个 SSHClient，并在本地 unix socket 上提供服务；其他进程连接该 socket 后，
+// 打开的 session、direct-tcpip 等通道都将经由 master 的连接转发，无需重新握手与认证。
+// socket 上使用的同样是 SSH 协议，其安全性依赖于 socket 文件的权限，因此不进行身份认证与主机公钥验证。
+
+const (
+	ControlCheck = "check" // 检查 master 是否在运行
+	ControlExit  = "exit"  // 请求 master 退出
+
+	controlRequestSuffix = "@control.gossh"
+)
+
+// ControlMaster 在本地 unix socket 上提供连接复用服务
+type ControlMaster struct {
+	client   *SSHClient
+	path     string
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// ServeControlMaster 在 socketPath 上监听并提供连接复用服务，socket 文件的权限为 0600。
+// 如果 socketPath 是当前用户所有的 unix socket 但没有 master 在运行，该文件将被删除后重新监听；
+// socketPath 为其它文件时返回错误。
+// 收到 exit 控制命令、调用 Close 或者 client 断开后，master 将停止服务并关闭 client。
+func ServeControlMaster(client *SSHClient, socketPath string) (*ControlMaster, error) {
+	if client == nil {
+		return nil, errors.New("invalid client")
+	}
+	if info, err := os.Lstat(socketPath); err == nil {
+		if !isOwnSocket(info) {
+			return nil, fmt.Errorf("%s already exists and is not a control socket owned by the current user", socketPath)
+		}
+		if SendControlCommand(socketPath, ControlCheck) == nil {
+			return nil, fmt.Errorf("control master already running on %s", socketPath)
+		}
+		os.Remove(socketPath)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	listener, err := listenControlSocket(socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cm := &ControlMaster{
+		client:   client,
+		path:     socketPath,
+		listener: listener,
+		config:   config,
+		done:     make(chan struct{}),
+	}
+	go cm.serve()
+	go func() {
+		select {
+		case <-client.closed:
+			cm.Close()
+		case <-cm.done:
+		}
+	}()
+	return cm, nil
+}
+
+// listenControlSocket 在 socketPath 上监听。socket 先在同一目录下权限为 0700 的临时目录中创建，设置权限为 0600 后再移动至 socketPath，
+// 以免在 Listen 与 Chmod 之间被其他用户连接
+func listenControlSocket(socketPath string) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(socketPath), ".cm")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "s")
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// socket 文件将被移动，由 Close 负责删除
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, socketPath); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// Path 返回 control socket 的路径
+func (cm *ControlMaster) Path() string {
+	return cm.path
+}
+
+// Wait 阻塞直至 master 停止服务
+func (cm *ControlMaster) Wait() {
+	<-cm.done
+}
+
+// Close 停止服务，删除 socket 文件并关闭 master 持有的连接
+func (cm *ControlMaster) Close() error {
+	cm.closeOnce.Do(func() {
+		cm.listener.Close()
+		os.Remove(cm.path)
+		cm.client.Close()
+		close(cm.done)
+	})
+	return nil
+}
+
+// serve 接受本地连接
+func (cm *ControlMaster) serve() {
+	for {
+		conn, err := cm.listener.Accept()
+		if err != nil {
+			return
+		}
+		go cm.handle(conn)
+	}
+}
+
+// handle 处理一个本地连接：控制命令由 master 自身处理，通道将被转发至 master 的连接上
+func (cm *ControlMaster) handle(conn net.Conn) {
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, cm.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer serverConn.Close()
+
+	go func() {
+		for req := range reqs {
+			switch req.Type {
+			case ControlCheck + controlRequestSuffix:
+				req.Reply(true, ssh.Marshal(struct{ Pid uint32 }{uint32(os.Getpid())}))
+			case ControlExit + controlRequestSuffix:
+				req.Reply(true, nil)
+				go cm.Close()
+			case KeepAliveRequest:
+				req.Reply(true, nil)
+			default:
+				// 远程端口转发所产生的 forwarded-tcpip 通道将由 master 的连接接收，无法转交给本地连接，因此拒绝其它全局请求
+				req.Reply(false, nil)
+			}
+		}
+	}()
+
+	for newChannel := range chans {
+		go cm.forwardChannel(newChannel)
+	}
+}
+
+// forwardChannel 在 master 的连接上打开相同类型的通道，并双向地转发数据以及请求
+func (cm *ControlMaster) forwardChannel(newChannel ssh.NewChannel) {
+	upstream, upstreamReqs, err := cm.client.Conn.OpenChannel(newChannel.ChannelType(), newChannel.ExtraData())
+	if err != nil {
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			newChannel.Reject(openErr.Reason, openErr.Message)
+		} else {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		}
+		return
+	}
+	local, localReqs, err := newChannel.Accept()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	proxyChannel(local, localReqs, upstream, upstreamReqs)
+}
+
+// proxyChannel 在两个通道之间转发数据、扩展数据（stderr）以及通道请求，直至任意一方关闭通道
+func proxyChannel(local ssh.Channel, localReqs <-chan *ssh.Request, upstream ssh.Channel, upstreamReqs <-chan *ssh.Request) {
+	var upstreamDone sync.WaitGroup
+	upstreamDone.Add(3)
+	go func() {
+		io.Copy(local, upstream)
+		local.CloseWrite()
+		upstreamDone.Done()
+	}()
+	go func() {
+		io.Copy(local.Stderr(), upstream.Stderr())
+		upstreamDone.Done()
+	}()
+	go func() {
+		// exit-status 等请求需要在关闭本地通道之前转发
+		for req := range upstreamReqs {
+			forwardRequest(local, req)
+		}
+		upstreamDone.Done()
+	}()
+
+	go func() {
+		io.Copy(upstream, local)
+		upstream.CloseWrite()
+	}()
+	// 服务端可能在回应 exec 等请求后立即关闭通道，正在转发的本地请求需要在关闭本地通道之前得到回应
+	var replying sync.Mutex
+	go func() {
+		for req := range localReqs {
+			replying.Lock()
+			forwardRequest(upstream, req)
+			replying.Unlock()
+		}
+		upstream.Close()
+	}()
+
+	upstreamDone.Wait()
+	replying.Lock()
+	local.Close()
+	replying.Unlock()
+}
+
+// forwardRequest 将请求发送至 to，并将回应返回给请求方
+func forwardRequest(to ssh.Channel, req *ssh.Request) {
+	ok, err := to.SendRequest(req.Type, req.WantReply, req.Payload)
+	if req.WantReply {
+		req.Reply(ok && err == nil, nil)
+	}
+}
+
+// dialControl 连接至 socketPath 上的 master
+func dialControl(socketPath string) (ssh.Conn, <-chan ssh.NewChannel, <-chan *ssh.Request, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, socketPath, &ssh.ClientConfig{
+		User:            "control",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+	return c, chans, reqs, nil
+}
+
+// ConnectControl 连接至 socketPath 上运行的 master，返回的 SSHClient 上打开的 session 以及 direct-tcpip 通道都经由 master 的连接转发。
+// 经由 master 的连接不支持 Listen 远程端口转发。
+func ConnectControl(socketPath string) (*SSHClient, error) {
+	return ConnectControlContext(context.Background(), socketPath, nil)
+}
+
+// ConnectControlContext 与 ConnectControl 相同，但可以通过 ctx 终止连接的建立；
+// config 不为 nil 时沿用其中的 Observer、Logger、Metrics、SendEnv、KeepAlive 等设置，身份认证、主机公钥验证以及算法等设置将被忽略
+func ConnectControlContext(ctx context.Context, socketPath string, config *Config) (*SSHClient, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	return handshakeContext(ctx, conn, socketPath, controlConfig(config))
+}
+
+// controlConfig 生成经由 master 连接时使用的配置：socket 上不进行身份认证与主机公钥验证，也不需要再次经由代理或者跳板机
+func controlConfig(config *Config) *Config {
+	c := Config{}
+	if config != nil {
+		c = *config
+	}
+	c.User = "control"
+	c.Auth = nil
+	c.HostKeyCallback = IgnoreHostKey
+	c.KeyExchanges, c.Ciphers, c.MACs, c.HostKeyAlgorithms = nil, nil, nil, nil
+	c.Dialer, c.Proxy, c.ProxyCommand, c.JumpHosts, c.ControlPath = nil, nil, "", nil, ""
+	return &c
+}
+
+// SendControlCommand 向 socketPath 上运行的 master 发送控制命令，command 为 ControlCheck 或 ControlExit 之一。
+// 返回的 error 为 nil 表明 master 正在运行并接受了该命令。
+func SendControlCommand(socketPath, command string) error {
+	if command != ControlCheck && command != ControlExit {
+		return fmt.Errorf("unknown control command '%s'", command)
+	}
+	c, chans, reqs, err := dialControl(socketPath)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	go ssh.DiscardRequests(reqs)
+	go func() {
+		for ch := range chans {
+			ch.Reject(ssh.Prohibited, "not supported")
+		}
+	}()
+
+	ok, _, err := c.SendRequest(command+controlRequestSuffix, true, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("control command '%s' rejected by master", command)
+	}
+	return nil
+}
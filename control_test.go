@@ -0,0 +1,223 @@
+package gossh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startControlMaster 连接至测试服务端，并在临时目录中的 socket 上启动 master
+func startControlMaster(t *testing.T) (*SSHClient, *ControlMaster) {
+	t.Helper()
+	server := startTestServer(t)
+	client, err := Connect(server.addr, testConfig(IgnoreHostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := ServeControlMaster(client, filepath.Join(t.TempDir(), "control.sock"))
+	if err != nil {
+		client.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { master.Close() })
+	return client, master
+}
+
+// connectCounter 统计 OnConnect 事件
+type connectCounter struct {
+	NopObserver
+	n int32
+}
+
+func (c *connectCounter) OnConnect(event ConnectEvent) {
+	if event.Err == nil {
+		atomic.AddInt32(&c.n, 1)
+	}
+}
+
+func TestControlMasterSocket(t *testing.T) {
+	_, master := startControlMaster(t)
+	info, err := os.Lstat(master.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %s, want 0600 socket", info.Mode())
+	}
+	// 创建 socket 时使用的临时目录不应残留
+	if entries, _ := ioutil.ReadDir(filepath.Dir(master.Path())); len(entries) != 1 {
+		t.Errorf("%d entries left in socket directory, want 1", len(entries))
+	}
+
+	// 调用者的 Observer、Metrics 需要沿用；身份认证与主机公钥验证则不应被使用
+	observer := &connectCounter{}
+	config := &Config{
+		User:     "someone",
+		Observer: observer,
+		Metrics:  NewMetricsRegistry(),
+		HostKeyCallback: func(hostname string, remote net.Addr, key PublicKey) error {
+			return errors.New("host key callback used for control connection")
+		},
+	}
+	control, err := ConnectControlContext(context.Background(), master.Path(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer control.Close()
+	if n := atomic.LoadInt32(&observer.n); n != 1 {
+		t.Errorf("observer saw %d connects, want 1", n)
+	}
+	if config.User != "someone" {
+		t.Error("caller config modified")
+	}
+
+	// exec 请求与 exit-status 经由 master 转发
+	session, err := control.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := session.RunForOutput("echo via master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != "echo via master" {
+		t.Errorf("output = %q", output)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ConnectControlContext(ctx, master.Path(), nil); err == nil {
+		t.Error("expected an error with a canceled context")
+	}
+}
+
+func TestControlMasterForwardsChannels(t *testing.T) {
+	_, master := startControlMaster(t)
+	echo := startEchoListener(t)
+
+	control, err := ConnectControl(master.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer control.Close()
+	conn, err := control.Dial("tcp", echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("via master")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len("via master"))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "via master" {
+		t.Fatalf("read %q, err = %v", buf, err)
+	}
+}
+
+func TestControlCommands(t *testing.T) {
+	client, master := startControlMaster(t)
+	if err := SendControlCommand(master.Path(), ControlCheck); err != nil {
+		t.Fatalf("check against a running master: %v", err)
+	}
+	if err := SendControlCommand(master.Path(), "stop"); err == nil {
+		t.Error("expected an error for an unknown command")
+	}
+	if _, err := ServeControlMaster(client, master.Path()); err == nil {
+		t.Error("expected an error when a master is already running")
+	}
+
+	// exit 停止 master，删除 socket 文件并关闭 master 持有的连接
+	if err := SendControlCommand(master.Path(), ControlExit); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		master.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("master still running after exit")
+	}
+	select {
+	case <-client.closed:
+	case <-time.After(time.Second):
+		t.Fatal("client not closed after exit")
+	}
+	if _, err := os.Lstat(master.Path()); !os.IsNotExist(err) {
+		t.Errorf("socket file left after exit: %v", err)
+	}
+	if err := SendControlCommand(master.Path(), ControlCheck); err == nil {
+		t.Error("check succeeded after exit")
+	}
+}
+
+func TestControlMasterStaleSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "control.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	if err := SendControlCommand(socketPath, ControlCheck); err == nil {
+		t.Fatal("check succeeded against a stale socket")
+	}
+
+	// 没有 master 在运行的 socket 文件将被替换
+	server := startTestServer(t)
+	client, err := Connect(server.addr, testConfig(IgnoreHostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := ServeControlMaster(client, socketPath)
+	if err != nil {
+		client.Close()
+		t.Fatal(err)
+	}
+	defer master.Close()
+	if err := SendControlCommand(socketPath, ControlCheck); err != nil {
+		t.Errorf("check after replacing a stale socket: %v", err)
+	}
+}
+
+func TestControlMasterKeepsOtherFiles(t *testing.T) {
+	server := startTestServer(t)
+	client, err := Connect(server.addr, testConfig(IgnoreHostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// 普通文件以及指向其它文件的符号链接都不应被删除或者替换
+	dir := t.TempDir()
+	regular := filepath.Join(dir, "control.sock")
+	if err := ioutil.WriteFile(regular, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.sock")
+	if err := os.Symlink(regular, link); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{regular, link} {
+		if master, err := ServeControlMaster(client, path); err == nil {
+			master.Close()
+			t.Fatalf("ServeControlMaster replaced %s", path)
+		}
+	}
+	if data, err := ioutil.ReadFile(regular); err != nil || string(data) != "data" {
+		t.Errorf("regular file = %q, %v", data, err)
+	}
+	if target, err := os.Readlink(link); err != nil || target != regular {
+		t.Errorf("symlink = %q, %v", target, err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package gossh
+
+import (
+	"os"
+	"syscall"
+)
+
+// isOwnSocket 判断 info 是否为当前用户所有的 unix socket
+func isOwnSocket(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && info.Mode()&os.ModeSocket != 0 && int(stat.Uid) == os.Getuid()
+}
@@ -0,0 +1,9 @@
+package gossh
+
+import "os"
+
+// isOwnSocket 判断 info 是否为 unix socket，Windows 上无法通过文件信息得知所有者，
+// 由 socket 所在目录的访问控制保证
+func isOwnSocket(info os.FileInfo) bool {
+	return info.Mode()&os.ModeSocket != 0
+}
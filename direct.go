@@ -3,20 +3,39 @@ package gossh
 import (
 	"context"
 	"errors"
-	"fmt"
 	"io"
 	"net"
-	"os"
 	"sync"
 )
 
 type Director struct {
 	client    *SSHClient
 	NewConnCb NewConnCallback
+	Logger    Logger           // 端口转发的日志输出，为 nil 时使用连接的 Config.Logger
+	Metrics   *MetricsRegistry // 端口转发的统计信息，为 nil 时使用连接的 Config.Metrics
 }
 
 type NewConnCallback func(conn net.Conn) (net.Conn, error)
 
+// logger 返回 Director 使用的 Logger
+func (d *Director) logger() Logger {
+	if d.Logger != nil {
+		return d.Logger
+	}
+	return d.client.logger()
+}
+
+// metrics 返回 Director 使用的 MetricsRegistry，可能为 nil
+func (d *Director) metrics() *MetricsRegistry {
+	if d.Metrics != nil {
+		return d.Metrics
+	}
+	if d.client.config != nil {
+		return d.client.config.Metrics
+	}
+	return nil
+}
+
 // BindConnTo 与 BindConnToWithBuffer 相同，但使用默认的 buf
 func (d *Director) BindConnTo(lconn net.Conn, netType, addr string, rctx, wctx context.Context) error {
 	return d.BindConnToWithBuffer(lconn, netType, addr, 0, rctx, wctx)
@@ -86,8 +105,16 @@ func (d *Director) bindConnsWithBuffer(lconn net.Conn, rconn net.Conn, bufSize i
 
 // RedirectToWithBuffer 通过传入的网络监听器接受网络连接，并尝试通过 direct-tcpip 信道打开一个远程端口并开始双向地复制数据。
 // 将会阻塞，直至 Listener.Accept 返回的 err 不为 nil。
-// 通过传入 Context 来控制 Deadline、终止监听以及终止流的复制。
+// 通过传入 Context 来控制 Deadline、终止监听以及终止流的复制；SSHClient.Shutdown 将关闭 listener 以停止转发。
 func (d *Director) RedirectToWithBuffer(listener net.Listener, netType, addr string, bufSize int, ctx context.Context) {
+	untrack, err := d.client.track(Resource{Kind: ResourceForward, Type: netType, Addr: addr, Listen: listener.Addr().String()}, listener.Close)
+	if err != nil {
+		d.logger().Log(LevelWarn, "forward not started", "listener", listener.Addr(), "error", err)
+		return
+	}
+	defer untrack()
+	metrics := d.metrics().addForward(listener.Addr().String(), addr)
+	defer d.metrics().removeForward(metrics)
 	for {
 		select {
 		case <-ctx.Done():
@@ -95,13 +122,16 @@ func (d *Director) RedirectToWithBuffer(listener net.Listener, netType, addr str
 		default:
 			lconn, err := listener.Accept()
 			if err != nil {
-				fmt.Println(err)
+				d.logger().Log(LevelWarn, "accept failed", "listener", listener.Addr(), "error", err)
 				return
 			}
-			fmt.Println(lconn.RemoteAddr().String())
+			d.logger().Log(LevelDebug, "connection accepted", "remote", lconn.RemoteAddr(), "to", addr)
+			lconn = metrics.track(lconn)
 			go func() {
 				rconn, err := d.client.Dial(netType, addr)
 				if err != nil {
+					d.logger().Log(LevelWarn, "dial through ssh failed", "network", netType, "addr", addr, "error", err)
+					lconn.Close()
 					return
 				}
 				var readBuf []byte = nil
@@ -112,16 +142,16 @@ func (d *Director) RedirectToWithBuffer(listener net.Listener, netType, addr str
 				}
 				// 开始并发传输数据 ：l->remote，当任何一方连接中断导致 Copy 函数返回，都要关闭两方连接
 				go func() {
-					CopyBufferWithContext(rconn, lconn, readBuf, ctx)
-					fmt.Println("l->r")
+					_, err := CopyBufferWithContext(rconn, lconn, readBuf, ctx)
+					d.logger().Log(LevelDebug, "forward finished", "direction", "local->remote", "remote", lconn.RemoteAddr(), "error", err)
 					lconn.Close()
 					rconn.Close()
 				}()
 
 				// 开始并发传输数据 ：remote->l，当任何一方连接中断导致 Copy 函数返回，都要关闭两方连接
 				go func() {
-					CopyBufferWithContext(lconn, rconn, writeBuf, ctx)
-					fmt.Println("r->l")
+					_, err := CopyBufferWithContext(lconn, rconn, writeBuf, ctx)
+					d.logger().Log(LevelDebug, "forward finished", "direction", "remote->local", "remote", lconn.RemoteAddr(), "error", err)
 					lconn.Close()
 					rconn.Close()
 				}()
@@ -137,8 +167,16 @@ func (d *Director) RedirectTo(localL net.Listener, netType, toAddr string, ctx c
 
 // DirectTcpToWithBuffer 通过传入的网络监听器接受网络连接，并尝试通过 direct-tcpip 信道打开一个远程端口并开始双向地复制数据。
 // 将会阻塞，直至 Listener.Accept 返回的 err 不为 nil。
-// 通过传入 Context 来控制 Deadline、终止监听以及终止流的复制。
+// 通过传入 Context 来控制 Deadline、终止监听以及终止流的复制；SSHClient.Shutdown 将关闭 listener 以停止转发。
 func (d *Director) DirectTcpToWithBuffer(listener net.Listener, to *net.TCPAddr, bufSize int, ctx context.Context) {
+	untrack, err := d.client.track(Resource{Kind: ResourceForward, Type: "tcp", Addr: to.String(), Listen: listener.Addr().String()}, listener.Close)
+	if err != nil {
+		d.logger().Log(LevelWarn, "forward not started", "listener", listener.Addr(), "error", err)
+		return
+	}
+	defer untrack()
+	metrics := d.metrics().addForward(listener.Addr().String(), to.String())
+	defer d.metrics().removeForward(metrics)
 	for {
 		select {
 		case <-ctx.Done():
@@ -146,16 +184,19 @@ func (d *Director) DirectTcpToWithBuffer(listener net.Listener, to *net.TCPAddr,
 		default:
 			lconn, err := listener.Accept()
 			if err != nil {
+				d.logger().Log(LevelWarn, "accept failed", "listener", listener.Addr(), "error", err)
 				return
 			}
 
 			if d.NewConnCb != nil {
 				if transFormedConn, err := d.NewConnCb(lconn); err != nil {
+					d.logger().Log(LevelWarn, "new connection callback failed", "remote", lconn.RemoteAddr(), "error", err)
 					return
 				} else {
 					lconn = transFormedConn
 				}
 			}
+			lconn = metrics.track(lconn)
 
 			go func() {
 				select {
@@ -163,11 +204,14 @@ func (d *Director) DirectTcpToWithBuffer(listener net.Listener, to *net.TCPAddr,
 					return
 				default:
 					origin, err := net.ResolveTCPAddr(lconn.RemoteAddr().Network(), lconn.LocalAddr().String())
-					fmt.Println(origin)
 					if err != nil {
+						d.logger().Log(LevelWarn, "resolve origin failed", "remote", lconn.RemoteAddr(), "error", err)
 						return
 					}
-					d.BindTcpConnToWithBuffer(lconn, origin, to, bufSize, ctx, ctx)
+					d.logger().Log(LevelDebug, "connection accepted", "origin", origin, "to", to)
+					if err := d.BindTcpConnToWithBuffer(lconn, origin, to, bufSize, ctx, ctx); err != nil {
+						d.logger().Log(LevelWarn, "dial through ssh failed", "network", "tcp", "addr", to, "error", err)
+					}
 				}
 			}()
 		}
@@ -210,7 +254,6 @@ func CopyBufferWithContext(dst io.Writer, src io.Reader, buf []byte, ctx context
 		default:
 			nr, er := src.Read(buf)
 			if nr > 0 {
-				os.Stdout.Write(buf[0:nr])
 				nw, ew := dst.Write(buf[0:nr])
 				if nw < 0 || nr < nw {
 					nw = 0
@@ -0,0 +1,262 @@
+package gossh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// 本文件定义了建立连接时返回的错误类型。ssh 包只返回字符串形式的握手错误，
+// 这里根据握手过程中记录的主机公钥验证结果、被尝试的身份认证方法以及双方的 KEXINIT 对其进行分类，可以通过 errors.Is 与 errors.As 判断：
+//
+//	var authErr *gossh.AuthError
+//	if errors.As(err, &authErr) {
+//		log.Println("tried", authErr.Methods)
+//	}
+//	if errors.Is(err, gossh.ErrHostKeyMismatch) { ... }
+
+var (
+	ErrDialTimeout          = errors.New("dial timeout")                 // 建立网络连接超时
+	ErrHandshake            = errors.New("ssh handshake failed")         // SSH 握手失败，以下错误均属于握手失败
+	ErrAuthFailed           = errors.New("authentication failed")        // 所有身份认证方法均失败
+	ErrUnknownHost          = errors.New("unknown host")                 // known_hosts 中没有该主机的记录
+	ErrHostKeyMismatch      = errors.New("host key mismatch")            // 服务端主机公钥与 known_hosts 中的记录不符
+	ErrAlgorithmNegotiation = errors.New("algorithm negotiation failed") // 双方没有共同支持的算法
+)
+
+// KnownKey known_hosts 中的一条公钥记录
+type KnownKey = knownhosts.KnownKey
+
+// DialError 建立网络连接失败，超时时 errors.Is(err, ErrDialTimeout) 为 true
+type DialError struct {
+	Addr string // 目标地址
+	Via  string // 经由的跳板机地址，直接连接时为空
+	Err  error
+}
+
+func (e *DialError) Error() string {
+	if e.Via != "" {
+		return fmt.Sprintf("dial %s through %s: %v", e.Addr, e.Via, e.Err)
+	}
+	return fmt.Sprintf("dial %s: %v", e.Addr, e.Err)
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DialError) Is(target error) bool {
+	return target == ErrDialTimeout && e.Timeout()
+}
+
+// Timeout 是否由于超时而失败
+func (e *DialError) Timeout() bool {
+	if errors.Is(e.Err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(e.Err, &netErr) && netErr.Timeout()
+}
+
+// HandshakeError SSH 握手或者身份认证失败，Err 为 *AuthError、*HostKeyError、*AlgorithmError 或者其它错误。
+// 无论 Err 为何种错误，errors.Is 与 errors.As 都能够找到 ssh.NewClientConn 返回的原始错误
+type HandshakeError struct {
+	Addr string
+	Err  error
+
+	cause error // ssh.NewClientConn 返回的原始错误，Err 的错误链中不包含该错误时不为 nil
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("ssh handshake with %s failed: %v", e.Addr, e.Err)
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *HandshakeError) Is(target error) bool {
+	return target == ErrHandshake || e.cause != nil && errors.Is(e.cause, target)
+}
+
+func (e *HandshakeError) As(target interface{}) bool {
+	return e.cause != nil && errors.As(e.cause, target)
+}
+
+// AuthError 服务端拒绝了所有身份认证方法，errors.Is(err, ErrAuthFailed) 为 true
+type AuthError struct {
+	User    string
+	Methods []string // 尝试过的身份认证方法，例如 publickey、password；只包含由 gossh 的函数生成的方法
+	Err     error
+}
+
+func (e *AuthError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+func (e *AuthError) Is(target error) bool {
+	return target == ErrAuthFailed
+}
+
+// HostKeyError 主机公钥未通过 known_hosts 验证。
+// Want 为空时表示 known_hosts 中没有该主机的记录，errors.Is(err, ErrUnknownHost) 为 true；
+// 否则表示主机公钥与记录不符，errors.Is(err, ErrHostKeyMismatch) 为 true
+type HostKeyError struct {
+	Host   string     // 连接时使用的主机名
+	Remote net.Addr   // 服务端地址
+	Key    PublicKey  // 服务端提供的主机公钥
+	Want   []KnownKey // known_hosts 中该主机的记录
+	Err    error
+}
+
+func (e *HostKeyError) Error() string {
+	fingerprint := ""
+	if e.Key != nil {
+		fingerprint = e.Key.Type() + " " + ssh.FingerprintSHA256(e.Key)
+	}
+	if len(e.Want) == 0 {
+		return fmt.Sprintf("unknown host %s (%s)", e.Host, fingerprint)
+	}
+	want := make([]string, 0, len(e.Want))
+	for _, known := range e.Want {
+		want = append(want, fmt.Sprintf("%s:%d", known.Filename, known.Line))
+	}
+	return fmt.Sprintf("host key mismatch for %s: got %s, known hosts at %s", e.Host, fingerprint, strings.Join(want, ", "))
+}
+
+func (e *HostKeyError) Unwrap() error {
+	return e.Err
+}
+
+func (e *HostKeyError) Is(target error) bool {
+	if len(e.Want) == 0 {
+		return target == ErrUnknownHost
+	}
+	return target == ErrHostKeyMismatch
+}
+
+// AlgorithmError 双方没有共同支持的算法，errors.Is(err, ErrAlgorithmNegotiation) 为 true
+type AlgorithmError struct {
+	What   string   // 协商的对象，例如 key exchange、host key、client to server cipher
+	Client []string // 客户端提供的算法
+	Server []string // 服务端提供的算法
+	Err    error
+}
+
+func (e *AlgorithmError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AlgorithmError) Unwrap() error {
+	return e.Err
+}
+
+func (e *AlgorithmError) Is(target error) bool {
+	return target == ErrAlgorithmNegotiation
+}
+
+// hostKeyCallbackError 其它主机公钥验证回调（例如 ssh.FixedHostKey）返回的错误
+type hostKeyCallbackError struct {
+	err error
+}
+
+func (e *hostKeyCallbackError) Error() string {
+	return e.err.Error()
+}
+
+func (e *hostKeyCallbackError) Unwrap() error {
+	return e.err
+}
+
+// handshakeCause 去除了 "ssh: handshake failed: " 前缀的握手错误，Unwrap 返回 ssh.NewClientConn 返回的原始错误
+type handshakeCause struct {
+	msg string
+	err error
+}
+
+func (e *handshakeCause) Error() string {
+	return e.msg
+}
+
+func (e *handshakeCause) Unwrap() error {
+	return e.err
+}
+
+// handshakeState 握手过程中记录的信息，用于对握手错误进行分类
+type handshakeState struct {
+	addr       string
+	user       string
+	remote     net.Addr
+	hostKey    PublicKey    // 主机公钥验证回调收到的公钥，为 nil 时表示密钥交换没有完成
+	hostKeyErr error        // 主机公钥验证回调返回的错误
+	tracker    *authTracker // 被尝试的身份认证方法
+	sniffer    *kexSniffer  // 双方的 KEXINIT 以及传输层的读写错误
+}
+
+// handshakeError 对 ssh.NewClientConn 返回的错误进行分类：
+// 主机公钥验证失败时为 *HostKeyError；主机公钥通过验证，且传输层没有发生读写错误时，错误发生在身份认证阶段，为 *AuthError；
+// 双方的 KEXINIT 中某一类算法没有交集时为 *AlgorithmError
+func handshakeError(state handshakeState, err error) error {
+	cause := &handshakeCause{msg: strings.TrimPrefix(err.Error(), "ssh: handshake failed: "), err: err}
+	if hostKeyErr := state.hostKeyErr; hostKeyErr != nil {
+		var checkErr *HostKeyError
+		var keyErr *knownhosts.KeyError
+		switch {
+		case errors.As(hostKeyErr, &checkErr):
+		case errors.As(hostKeyErr, &keyErr):
+			hostKeyErr = &HostKeyError{Host: state.addr, Remote: state.remote, Key: state.hostKey, Want: keyErr.Want, Err: keyErr}
+		default:
+			hostKeyErr = &hostKeyCallbackError{hostKeyErr}
+		}
+		return &HandshakeError{Addr: state.addr, Err: hostKeyErr, cause: cause}
+	}
+
+	if state.hostKey != nil && (state.sniffer == nil || state.sniffer.ioError() == nil) {
+		var methods []string
+		if state.tracker != nil {
+			methods = state.tracker.methods()
+		}
+		return &HandshakeError{Addr: state.addr, Err: &AuthError{User: state.user, Methods: methods, Err: cause}}
+	}
+	if state.sniffer != nil {
+		if algoErr := state.sniffer.mismatch(); algoErr != nil {
+			algoErr.Err = cause
+			return &HandshakeError{Addr: state.addr, Err: algoErr}
+		}
+	}
+	return &HandshakeError{Addr: state.addr, Err: cause}
+}
+
+// IsTransient 判断建立连接时的错误是否是暂时性的，即重试或者连接其它地址可能成功：
+// 网络连接失败或超时、握手过程中连接中断等情况为暂时性错误；
+// 身份认证失败、主机公钥验证失败、算法协商失败、域名不存在以及 context 被取消不是暂时性错误
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrAuthFailed) || errors.Is(err, ErrUnknownHost) || errors.Is(err, ErrHostKeyMismatch) ||
+		errors.Is(err, ErrAlgorithmNegotiation) {
+		return false
+	}
+	var hostKeyErr *HostKeyError
+	var callbackErr *hostKeyCallbackError
+	if errors.As(err, &hostKeyErr) || errors.As(err, &callbackErr) {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	var dialErr *DialError
+	var handshakeErr *HandshakeError
+	return errors.As(err, &dialErr) || errors.As(err, &handshakeErr)
+}
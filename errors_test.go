@@ -0,0 +1,138 @@
+package gossh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestHandshakeErrorKeepsCause(t *testing.T) {
+	sentinel := errors.New("ssh: unable to authenticate, attempted methods [none password], no supported methods remain")
+	hostKey := newTestSigner(t).PublicKey()
+	tracker := &authTracker{}
+	tracker.attempt("publickey")
+	tracker.attempt("password")
+	tracker.attempt("publickey")
+	mismatched := &kexSniffer{}
+	mismatched.client.kexInit = &kexInit{KexAlgos: []string{"curve25519-sha256"}, ServerHostKeyAlgos: []string{"ssh-ed25519"},
+		CiphersClientServer: []string{"aes128-ctr"}, CiphersServerClient: []string{"aes128-ctr"}}
+	mismatched.server.kexInit = &kexInit{KexAlgos: []string{"curve25519-sha256"}, ServerHostKeyAlgos: []string{"ssh-ed25519"},
+		CiphersClientServer: []string{"aes256-gcm@openssh.com"}, CiphersServerClient: []string{"aes128-ctr"}}
+	dropped := &kexSniffer{ioErr: io.EOF}
+
+	tests := []struct {
+		name  string
+		state handshakeState
+		err   error
+		is    error
+		msg   string
+	}{
+		{
+			name:  "auth",
+			state: handshakeState{hostKey: hostKey, tracker: tracker, sniffer: &kexSniffer{}},
+			err:   fmt.Errorf("ssh: handshake failed: %w", sentinel),
+			is:    ErrAuthFailed,
+			msg:   sentinel.Error(),
+		},
+		{
+			name:  "host key",
+			state: handshakeState{hostKey: hostKey, hostKeyErr: &knownhosts.KeyError{Want: []knownhosts.KnownKey{{Key: hostKey}}}},
+			err:   errors.New("ssh: handshake failed: knownhosts: key mismatch"),
+			is:    ErrHostKeyMismatch,
+			msg:   "host key mismatch for 127.0.0.1:22: got " + hostKey.Type() + " " + ssh.FingerprintSHA256(hostKey) + ", known hosts at :0",
+		},
+		{
+			name:  "algorithm",
+			state: handshakeState{sniffer: mismatched},
+			err:   errors.New("ssh: handshake failed: ssh: no common algorithm for client to server cipher"),
+			is:    ErrAlgorithmNegotiation,
+			msg:   "ssh: no common algorithm for client to server cipher",
+		},
+		{
+			name:  "dropped after host key",
+			state: handshakeState{hostKey: hostKey, tracker: tracker, sniffer: dropped},
+			err:   errors.New("ssh: handshake failed: EOF"),
+			is:    ErrHandshake,
+			msg:   "EOF",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.state.addr, tt.state.user = "127.0.0.1:22", "tester"
+			err := handshakeError(tt.state, tt.err)
+			if !errors.Is(err, tt.is) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tt.is)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("original error lost from the chain of %v", err)
+			}
+			var cause *handshakeCause
+			if !errors.As(err, &cause) || cause.err != tt.err {
+				t.Errorf("handshakeCause missing from the chain of %v", err)
+			}
+			if want := "ssh handshake with 127.0.0.1:22 failed: " + tt.msg; err.Error() != want {
+				t.Errorf("message = %q, want %q", err.Error(), want)
+			}
+		})
+	}
+
+	// 认证方法来自 authTracker，按照第一次尝试的顺序排列；原始错误中包装的错误同样可以被找到
+	err := handshakeError(handshakeState{addr: "127.0.0.1:22", hostKey: hostKey, tracker: tracker}, fmt.Errorf("ssh: handshake failed: %w", sentinel))
+	if !errors.Is(err, sentinel) {
+		t.Errorf("wrapped error lost from the chain of %v", err)
+	}
+	var authErr *AuthError
+	if !errors.As(err, &authErr) || !reflect.DeepEqual(authErr.Methods, []string{"publickey", "password"}) {
+		t.Errorf("AuthError = %+v", authErr)
+	}
+
+	var algoErr *AlgorithmError
+	err = handshakeError(handshakeState{addr: "127.0.0.1:22", sniffer: mismatched}, errors.New("ssh: handshake failed"))
+	if !errors.As(err, &algoErr) || algoErr.What != "client to server cipher" ||
+		!reflect.DeepEqual(algoErr.Client, []string{"aes128-ctr"}) || !reflect.DeepEqual(algoErr.Server, []string{"aes256-gcm@openssh.com"}) {
+		t.Errorf("AlgorithmError = %+v", algoErr)
+	}
+}
+
+func TestConnectAlgorithmMismatch(t *testing.T) {
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true, Config: ssh.Config{Ciphers: []string{"aes256-ctr"}}}
+	serverConfig.AddHostKey(newTestSigner(t))
+	addr := listenTestTCP(t, func(conn net.Conn) { serveTestConn(conn, serverConfig) })
+
+	config := testConfig(IgnoreHostKey)
+	config.Ciphers = []string{"aes128-ctr"}
+	_, err := Connect(addr, config)
+	var algoErr *AlgorithmError
+	if !errors.As(err, &algoErr) || algoErr.What != "client to server cipher" {
+		t.Fatalf("err = %v, want AlgorithmError for the client to server cipher", err)
+	}
+	if !reflect.DeepEqual(algoErr.Client, []string{"aes128-ctr"}) || !reflect.DeepEqual(algoErr.Server, []string{"aes256-ctr"}) {
+		t.Errorf("AlgorithmError = %+v", algoErr)
+	}
+}
+
+func TestConnectAuthFailure(t *testing.T) {
+	server := startTestServer(t)
+	config := DefaultConfigAuthByPasswd("tester", "wrong")
+	_, err := Connect(server.addr, config)
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("err = %v, want ErrAuthFailed", err)
+	}
+	if IsTransient(err) {
+		t.Error("authentication failure reported as transient")
+	}
+	var authErr *AuthError
+	if !errors.As(err, &authErr) || authErr.User != "tester" || !reflect.DeepEqual(authErr.Methods, []string{"password"}) {
+		t.Fatalf("AuthError = %+v", authErr)
+	}
+	var cause *handshakeCause
+	if !errors.As(err, &cause) || cause.err == nil {
+		t.Errorf("original handshake error missing from %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package gossh
 
 import (
+	"context"
 	"golang.org/x/crypto/ssh"
 	"net"
 )
@@ -9,8 +10,14 @@ type BannerCallback func(message string) error
 
 type HostKeyCallback func(hostname string, remote net.Addr, key PublicKey) error
 
+// DialFunc 用于建立承载 SSH 协议的网络连接，network 与 addr 的含义与 net.Dial 相同
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
 // RetryableAuthMethod 是其他 auth 方法的装饰器，使它们能够在考虑 AuthMethod 本身失败之前重试到 maxTries。如果 maxTries <= 0，将无限期重试
 func RetryableAuthMethod(auth AuthMethod, maxTries int) AuthMethod {
+	if m, ok := auth.(*authMethod); ok {
+		return retryableAuth(m, maxTries)
+	}
 	return ssh.RetryableAuthMethod(auth, maxTries)
 }
 
@@ -42,7 +49,7 @@ type KeyboardInteractiveChallenge func(name, instruction string, questions []str
 
 // KeyboardInteractive 返回一个 AuthMethod
 func KeyboardInteractive(challenge KeyboardInteractiveChallenge) AuthMethod {
-	return ssh.KeyboardInteractive(ssh.KeyboardInteractiveChallenge(challenge))
+	return keyboardInteractiveAuth(ssh.KeyboardInteractiveChallenge(challenge))
 }
 
 type NewChannel interface {
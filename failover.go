@@ -0,0 +1,334 @@
+package gossh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// 本文件实现了在多个候选地址之间故障转移、并按照重试策略重试的连接方式。
+// 主机名将被解析为全部的 A/AAAA 记录，并以类似 Happy Eyeballs（RFC 8305）的方式交替、错开地建立网络连接，
+// 最先建立的网络连接用于 SSH 握手
+
+// DefaultFallbackDelay RetryPolicy.FallbackDelay 未设置时，开始连接下一个地址前等待的时间
+const DefaultFallbackDelay = 300 * time.Millisecond
+
+// RetryPolicy ConnectFailover 的重试策略
+type RetryPolicy struct {
+	MaxAttempts   int                           // 对全部候选地址的最大尝试轮数，小于等于 0 时为 3
+	Backoff       Backoff                       // 两轮尝试之间的退避策略
+	FallbackDelay time.Duration                 // 同一轮中开始连接下一个地址前等待的时间，为 0 时使用 DefaultFallbackDelay，小于 0 时等待上一个地址失败后才开始
+	Retryable     func(err error) bool          // 判断错误能否通过重试或者连接其它地址解决，为 nil 时使用 IsTransient
+	OnAttempt     func(attempt FailoverAttempt) // 每个地址连接成功或者失败后被调用，不应长时间阻塞
+}
+
+// FailoverAttempt 一次对单个地址的连接尝试
+type FailoverAttempt struct {
+	Round  int    // 尝试的轮数，从 1 开始
+	Addr   string // 候选地址，用于主机公钥验证
+	Dialed string // 实际连接的地址，主机名被解析时为 IP:port
+	Err    error  // 为 nil 时表示连接成功
+}
+
+// FailoverError 所有候选地址的所有尝试均失败
+type FailoverError struct {
+	Attempts []FailoverAttempt
+}
+
+func (e *FailoverError) Error() string {
+	if len(e.Attempts) == 0 {
+		return "no address to connect"
+	}
+	last := e.Attempts[len(e.Attempts)-1]
+	return fmt.Sprintf("all %d connection attempts failed, last %s: %v", len(e.Attempts), last.Dialed, last.Err)
+}
+
+// Unwrap 返回最后一次尝试的错误
+func (e *FailoverError) Unwrap() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return e.Attempts[len(e.Attempts)-1].Err
+}
+
+// dialTarget 一个候选的网络地址
+type dialTarget struct {
+	addr string // 候选地址
+	dial string // 实际连接的地址
+}
+
+// ConnectFailover 依次尝试 addrs 中的候选地址，返回建立的连接以及成功的候选地址（实际连接的地址可通过 RemoteAddr 获取）。
+// 没有使用 Dialer、代理与 ProxyCommand 时，主机名将被解析为全部的 IP 地址，各个地址的网络连接以 policy.FallbackDelay 为间隔错开开始，
+// 最先建立的网络连接用于 SSH 握手，握手失败时继续使用其余的地址；
+// config.JumpHosts 或者 config.ControlPath 不为空时，将依次对各个候选地址调用 ConnectContext。
+// 一轮中所有地址均失败后，按照 policy.Backoff 等待并开始下一轮；遇到不可重试的错误时立即返回该错误，
+// 尝试次数耗尽时返回 *FailoverError
+func ConnectFailover(ctx context.Context, addrs []string, config *Config, policy RetryPolicy) (*SSHClient, string, error) {
+	if config == nil {
+		return nil, "", errors.New("invalid config")
+	}
+	if len(addrs) == 0 {
+		return nil, "", &FailoverError{}
+	}
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+
+	failure := &FailoverError{}
+	report := func(attempt FailoverAttempt) {
+		if attempt.Err != nil {
+			failure.Attempts = append(failure.Attempts, attempt)
+		}
+		loggerOf(config).Log(LevelDebug, "connect attempt", "round", attempt.Round, "addr", attempt.Addr, "dialed", attempt.Dialed, "error", attempt.Err)
+		if policy.OnAttempt != nil {
+			policy.OnAttempt(attempt)
+		}
+	}
+
+	for round := 1; ; round++ {
+		var client *SSHClient
+		var addr string
+		var err error
+		if len(config.JumpHosts) > 0 || config.ControlPath != "" {
+			client, addr, err = connectSequentially(ctx, round, addrs, config, retryable, report)
+		} else {
+			client, addr, err = connectRacing(ctx, round, addrs, config, policy.FallbackDelay, retryable, report)
+		}
+		if client != nil {
+			return client, addr, nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if round >= maxAttempts {
+			return nil, "", failure
+		}
+
+		timer := time.NewTimer(policy.Backoff.Delay(round))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, "", ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// connectSequentially 依次对各个候选地址调用 ConnectContext。
+// 返回的错误不为 nil 时表示不应继续重试；连接与错误均为 nil 时表示本轮所有地址均失败
+func connectSequentially(ctx context.Context, round int, addrs []string, config *Config,
+	retryable func(error) bool, report func(FailoverAttempt)) (*SSHClient, string, error) {
+	for _, addr := range addrs {
+		client, err := ConnectContext(ctx, addr, config)
+		report(FailoverAttempt{Round: round, Addr: addr, Dialed: addr, Err: err})
+		if err == nil {
+			return client, addr, nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		if !retryable(err) {
+			return nil, "", err
+		}
+	}
+	return nil, "", nil
+}
+
+// connectRacing 解析所有候选地址，错开地建立网络连接，并在最先建立的连接上完成握手，握手失败时继续使用其余的地址。
+// 返回值的含义与 connectSequentially 相同
+func connectRacing(ctx context.Context, round int, addrs []string, config *Config, delay time.Duration,
+	retryable func(error) bool, report func(FailoverAttempt)) (*SSHClient, string, error) {
+	targets, stop := resolveTargets(ctx, round, addrs, config, retryable, report)
+	if stop != nil {
+		return nil, "", stop
+	}
+	if delay == 0 {
+		delay = DefaultFallbackDelay
+	}
+
+	dialer := dialerOf(config)
+	for len(targets) > 0 {
+		dialCtx, cancel := context.WithTimeout(ctx, dialTimeout(config))
+		conn, winner, failed := raceDial(dialCtx, dialer, targets, delay)
+		cancel()
+
+		var remaining []dialTarget
+		for i, target := range targets {
+			if err := failed[i]; err != nil {
+				err = &DialError{Addr: target.dial, Err: err}
+				observerOf(config).OnConnect(ConnectEvent{Addr: target.addr, User: config.User, Err: err})
+				report(FailoverAttempt{Round: round, Addr: target.addr, Dialed: target.dial, Err: err})
+				if ctx.Err() != nil {
+					return nil, "", ctx.Err()
+				}
+				if !retryable(err) {
+					return nil, "", err
+				}
+				continue
+			}
+			if i != winner {
+				remaining = append(remaining, target)
+			}
+		}
+		if conn == nil {
+			return nil, "", nil
+		}
+
+		target := targets[winner]
+		client, err := handshakeContext(ctx, conn, target.addr, config)
+		report(FailoverAttempt{Round: round, Addr: target.addr, Dialed: target.dial, Err: err})
+		if err == nil {
+			return client, target.addr, nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		if !retryable(err) {
+			return nil, "", err
+		}
+		targets = remaining
+	}
+	return nil, "", nil
+}
+
+// resolveTargets 将候选地址中的主机名解析为 IP 地址；设置了 Dialer、代理或者 ProxyCommand 时由它们解析，候选地址保持不变。
+// 解析失败的地址将被报告并跳过；ctx 被取消，或者所有地址均解析失败且错误均不可重试时 stop 不为 nil
+func resolveTargets(ctx context.Context, round int, addrs []string, config *Config,
+	retryable func(error) bool, report func(FailoverAttempt)) (targets []dialTarget, stop error) {
+	retry := false
+	for _, addr := range addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || config.Dialer != nil || config.Proxy != nil || config.ProxyCommand != "" || net.ParseIP(host) != nil {
+			targets = append(targets, dialTarget{addr: addr, dial: addr})
+			continue
+		}
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			err = &DialError{Addr: addr, Err: err}
+			observerOf(config).OnConnect(ConnectEvent{Addr: addr, User: config.User, Err: err})
+			report(FailoverAttempt{Round: round, Addr: addr, Dialed: addr, Err: err})
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			retry = retry || retryable(err)
+			stop = err
+			continue
+		}
+		for _, ip := range interleaveFamilies(ips) {
+			targets = append(targets, dialTarget{addr: addr, dial: net.JoinHostPort(ip.String(), port)})
+		}
+	}
+	if len(targets) > 0 || retry {
+		return targets, nil
+	}
+	return nil, stop
+}
+
+// interleaveFamilies 以第一个地址的协议族开始，交替排列 IPv6 与 IPv4 地址
+func interleaveFamilies(ips []net.IPAddr) []net.IPAddr {
+	if len(ips) == 0 {
+		return nil
+	}
+	var first, second []net.IPAddr
+	firstIsV4 := ips[0].IP.To4() != nil
+	for _, ip := range ips {
+		if (ip.IP.To4() != nil) == firstIsV4 {
+			first = append(first, ip)
+		} else {
+			second = append(second, ip)
+		}
+	}
+	result := make([]net.IPAddr, 0, len(ips))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			result = append(result, first[i])
+		}
+		if i < len(second) {
+			result = append(result, second[i])
+		}
+	}
+	return result
+}
+
+// raceDial 以 delay 为间隔依次开始连接 targets，某个连接失败时立即开始下一个，返回最先建立的连接及其下标。
+// failed 记录已经失败的连接的错误；没有连接成功时 conn 为 nil，winner 为 -1。其余迟到的连接将被关闭
+func raceDial(ctx context.Context, dialer DialFunc, targets []dialTarget, delay time.Duration) (conn net.Conn, winner int, failed []error) {
+	type result struct {
+		i    int
+		conn net.Conn
+		err  error
+	}
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan result, len(targets))
+	failed = make([]error, len(targets))
+
+	started, pending := 0, 0
+	start := func() {
+		i := started
+		started++
+		pending++
+		go func() {
+			conn, err := dialer(raceCtx, "tcp", targets[i].dial)
+			results <- result{i, conn, err}
+		}()
+	}
+
+	var timer *time.Timer
+	var next <-chan time.Time
+	if delay > 0 {
+		timer = time.NewTimer(delay)
+		defer timer.Stop()
+		next = timer.C
+	}
+
+	start()
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				cancel()
+				go func(n int) {
+					for ; n > 0; n-- {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, r.i, failed
+			}
+			failed[r.i] = r.err
+			if started < len(targets) {
+				start()
+				if timer != nil {
+					resetTimer(timer, delay)
+				}
+			}
+		case <-next:
+			if started < len(targets) {
+				start()
+				resetTimer(timer, delay)
+			}
+		}
+	}
+	return nil, -1, failed
+}
+
+// resetTimer 停止 timer 并丢弃已经到期但尚未读取的值后重新计时，以免 Reset 之后立即读到过期的值
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
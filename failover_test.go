@@ -0,0 +1,150 @@
+package gossh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInterleaveFamilies(t *testing.T) {
+	v4a, v4b := net.IPAddr{IP: net.ParseIP("192.0.2.1")}, net.IPAddr{IP: net.ParseIP("192.0.2.2")}
+	v6a, v6b := net.IPAddr{IP: net.ParseIP("2001:db8::1")}, net.IPAddr{IP: net.ParseIP("2001:db8::2")}
+	tests := []struct {
+		in   []net.IPAddr
+		want []net.IPAddr
+	}{
+		{in: nil, want: nil},
+		{in: []net.IPAddr{v4a, v4b}, want: []net.IPAddr{v4a, v4b}},
+		{in: []net.IPAddr{v6a, v6b, v4a, v4b}, want: []net.IPAddr{v6a, v4a, v6b, v4b}},
+		{in: []net.IPAddr{v4a, v4b, v6a}, want: []net.IPAddr{v4a, v6a, v4b}},
+	}
+	for _, tt := range tests {
+		if got := interleaveFamilies(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("interleaveFamilies(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestResetTimerDropsStaleTick(t *testing.T) {
+	timer := time.NewTimer(time.Millisecond)
+	defer timer.Stop()
+	time.Sleep(20 * time.Millisecond) // 到期但尚未读取
+	resetTimer(timer, time.Hour)
+	select {
+	case <-timer.C:
+		t.Fatal("stale tick received after reset")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRaceDial(t *testing.T) {
+	refused := errors.New("connection refused")
+	var mu sync.Mutex
+	var order []string
+	dialer := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		mu.Lock()
+		order = append(order, addr)
+		mu.Unlock()
+		switch addr {
+		case "fail":
+			return nil, refused
+		case "hang":
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+	targets := []dialTarget{{dial: "fail"}, {dial: "hang"}, {dial: "ok"}}
+
+	start := time.Now()
+	conn, winner, failed := raceDial(context.Background(), dialer, targets, 100*time.Millisecond)
+	if conn == nil {
+		t.Fatal("no connection established")
+	}
+	conn.Close()
+	if winner != 2 {
+		t.Errorf("winner = %d, want 2", winner)
+	}
+	if failed[0] != refused {
+		t.Errorf("failed[0] = %v", failed[0])
+	}
+	// 第一个地址立即失败时第二个地址立即开始，第三个地址在间隔之后开始
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("third target started after %s, want at least 100ms", elapsed)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(order, []string{"fail", "hang", "ok"}) {
+		t.Errorf("dial order = %v", order)
+	}
+}
+
+func TestConnectFailover(t *testing.T) {
+	server := startTestServer(t)
+	// 已经关闭的端口，连接将被拒绝
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := listener.Addr().String()
+	listener.Close()
+
+	var attempts []FailoverAttempt
+	policy := RetryPolicy{MaxAttempts: 1, OnAttempt: func(attempt FailoverAttempt) {
+		attempts = append(attempts, attempt)
+	}}
+	client, addr, err := ConnectFailover(context.Background(), []string{dead, server.addr}, testConfig(IgnoreHostKey), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if addr != server.addr {
+		t.Errorf("addr = %s, want %s", addr, server.addr)
+	}
+	if len(attempts) != 2 || attempts[0].Err == nil || attempts[1].Err != nil {
+		t.Errorf("attempts = %+v", attempts)
+	}
+
+	// 身份认证失败不可重试，不应继续尝试其它地址
+	attempts = nil
+	config := DefaultConfigAuthByPasswd("tester", "wrong")
+	_, _, err = ConnectFailover(context.Background(), []string{server.addr, server.addr}, config, RetryPolicy{MaxAttempts: 3,
+		OnAttempt: func(attempt FailoverAttempt) { attempts = append(attempts, attempt) }})
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("err = %v, want ErrAuthFailed", err)
+	}
+	if len(attempts) != 1 {
+		t.Errorf("%d attempts after an authentication failure, want 1", len(attempts))
+	}
+}
+
+func TestConnectFailoverDialerResolves(t *testing.T) {
+	server := startTestServer(t)
+	// 只有 Dialer 认识的主机名，由本地解析时将失败
+	var dialed []string
+	config := testConfig(IgnoreHostKey)
+	config.Dialer = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		if addr != "backend.virtual.invalid:22" {
+			return nil, fmt.Errorf("unknown virtual host %s", addr)
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, server.addr)
+	}
+
+	client, addr, err := ConnectFailover(context.Background(), []string{"backend.virtual.invalid:22"}, config, RetryPolicy{MaxAttempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if addr != "backend.virtual.invalid:22" || len(dialed) != 1 || dialed[0] != addr {
+		t.Errorf("addr = %s, dialed = %v", addr, dialed)
+	}
+}
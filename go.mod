@@ -6,4 +6,5 @@ require (
 	github.com/pkg/sftp v1.13.4
 	golang.org/x/crypto v0.0.0-20220427172511-eb4f295cb31f
 	golang.org/x/term v0.0.0-20220411215600-e5f449aeb171
+	gopkg.in/yaml.v3 v3.0.1
 )
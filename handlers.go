@@ -0,0 +1,96 @@
+package gossh
+
+import (
+	"golang.org/x/crypto/ssh"
+)
+
+// 本文件实现了对服务端主动发起的全局请求以及通道的处理
+
+// GlobalRequestHandler 处理服务端发送的全局请求，返回值将作为请求的回应（仅在 req.WantReply 为 true 时发送）。
+// 处理函数不应调用 req.Reply
+type GlobalRequestHandler func(client *SSHClient, req *ssh.Request) (ok bool, payload []byte)
+
+// ChannelHandler 处理服务端请求打开的通道，处理函数负责调用 newChannel.Accept 或 newChannel.Reject
+type ChannelHandler func(client *SSHClient, newChannel NewChannel)
+
+// HandleGlobalRequest 注册名称为 name 的全局请求的处理函数，handler 为 nil 时取消注册。
+// 没有注册处理函数的全局请求将被拒绝。
+// 全局请求按照到达的顺序依次处理，处理函数长时间阻塞将延迟之后的请求；
+// 在连接建立后立即到达的请求（例如 hostkeys-00@openssh.com）需要通过 Config.GlobalRequestHandlers 预先注册
+func (client *SSHClient) HandleGlobalRequest(name string, handler GlobalRequestHandler) {
+	client.handlersMu.Lock()
+	defer client.handlersMu.Unlock()
+	if handler == nil {
+		delete(client.requestHandlers, name)
+		return
+	}
+	client.requestHandlers[name] = handler
+}
+
+// HandleChannel 注册类型为 channelType 的通道的处理函数，handler 为 nil 时取消注册。
+// 每个通道都在单独的协程中处理。没有注册处理函数的通道交由 ssh.Client 处理：
+// forwarded-tcpip 与 forwarded-streamlocal@openssh.com 通道用于 Listen 的远程端口转发，其余类型将被拒绝。
+// 注册 forwarded-tcpip 等类型的处理函数后，Listen 返回的监听器将无法再接收到连接
+func (client *SSHClient) HandleChannel(channelType string, handler ChannelHandler) {
+	client.handlersMu.Lock()
+	defer client.handlersMu.Unlock()
+	if handler == nil {
+		delete(client.channelHandlers, channelType)
+		return
+	}
+	client.channelHandlers[channelType] = handler
+}
+
+// initHandlers 以 config 中预先注册的处理函数初始化连接的处理函数
+func (client *SSHClient) initHandlers(config *Config) {
+	client.requestHandlers = make(map[string]GlobalRequestHandler)
+	client.channelHandlers = make(map[string]ChannelHandler)
+	for name, handler := range config.GlobalRequestHandlers {
+		if handler != nil {
+			client.requestHandlers[name] = handler
+		}
+	}
+	for channelType, handler := range config.ChannelHandlers {
+		if handler != nil {
+			client.channelHandlers[channelType] = handler
+		}
+	}
+}
+
+// handleGlobalRequests 分发服务端发送的全局请求
+func (client *SSHClient) handleGlobalRequests(reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		client.handlersMu.RLock()
+		handler := client.requestHandlers[req.Type]
+		client.handlersMu.RUnlock()
+
+		if handler == nil {
+			// 与 ssh.Client 的行为相同，拒绝所有未知的请求
+			req.Reply(false, nil)
+			continue
+		}
+		ok, payload := handler(client, req)
+		if req.WantReply {
+			req.Reply(ok, payload)
+		}
+	}
+}
+
+// handleChannels 分发服务端请求打开的通道，没有注册处理函数的通道将被发送至 unhandled
+func (client *SSHClient) handleChannels(chans <-chan ssh.NewChannel, unhandled chan<- ssh.NewChannel) {
+	defer close(unhandled)
+	for newChannel := range chans {
+		if client.rejectIfClosing(newChannel) {
+			continue
+		}
+		client.handlersMu.RLock()
+		handler := client.channelHandlers[newChannel.ChannelType()]
+		client.handlersMu.RUnlock()
+
+		if handler == nil {
+			unhandled <- newChannel
+			continue
+		}
+		go handler(client, newChannel)
+	}
+}
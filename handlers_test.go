@@ -0,0 +1,113 @@
+package gossh
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// serverInitiated 由测试服务端主动发起的请求的结果
+type serverInitiated struct {
+	earlyOK      bool   // 握手后立即发送的 early@test 全局请求是否被接受
+	earlyPayload []byte // early@test 的回应内容
+	unknownOK    bool   // 未注册的 unknown@test 全局请求是否被接受
+	channelData  []byte // 服务端打开的 push@test 通道中读取到的数据
+	rejected     bool   // 未注册的 other@test 通道是否被拒绝
+}
+
+// startInitiatingServer 启动一个在握手后主动向客户端发送全局请求，并在收到 trigger@test 请求后打开通道的测试服务端
+func startInitiatingServer(t *testing.T) (string, <-chan serverInitiated) {
+	t.Helper()
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(newTestSigner(t))
+	results := make(chan serverInitiated, 1)
+	addr := listenTestTCP(t, func(conn net.Conn) {
+		defer conn.Close()
+		serverConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			return
+		}
+		go func() {
+			for newChannel := range chans {
+				newChannel.Reject(ssh.Prohibited, "no channels")
+			}
+		}()
+
+		var result serverInitiated
+		result.earlyOK, result.earlyPayload, _ = serverConn.SendRequest("early@test", true, nil)
+		result.unknownOK, _, _ = serverConn.SendRequest("unknown@test", true, nil)
+
+		// 等待客户端注册通道处理函数
+		for req := range reqs {
+			if req.Type != "trigger@test" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			break
+		}
+		go ssh.DiscardRequests(reqs)
+
+		if channel, requests, err := serverConn.OpenChannel("push@test", nil); err == nil {
+			go ssh.DiscardRequests(requests)
+			result.channelData, _ = ioutil.ReadAll(channel)
+			channel.Close()
+		}
+		_, _, err = serverConn.OpenChannel("other@test", nil)
+		_, result.rejected = err.(*ssh.OpenChannelError)
+		results <- result
+	})
+	return addr, results
+}
+
+func TestServerInitiatedHandlers(t *testing.T) {
+	addr, results := startInitiatingServer(t)
+	config := &Config{
+		User:            "tester",
+		HostKeyCallback: IgnoreHostKey,
+		GlobalRequestHandlers: map[string]GlobalRequestHandler{
+			"early@test": func(client *SSHClient, req *ssh.Request) (bool, []byte) {
+				return true, []byte("pong")
+			},
+		},
+	}
+	client, err := Connect(addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	client.HandleChannel("push@test", func(client *SSHClient, newChannel NewChannel) {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(requests)
+		channel.Write([]byte("pushed"))
+		channel.Close()
+	})
+	if ok, _, err := client.SendRequest("trigger@test", true, nil); err != nil || !ok {
+		t.Fatalf("trigger rejected: %v", err)
+	}
+
+	select {
+	case result := <-results:
+		if !result.earlyOK || string(result.earlyPayload) != "pong" {
+			t.Errorf("early@test: ok = %v, payload = %q", result.earlyOK, result.earlyPayload)
+		}
+		if result.unknownOK {
+			t.Error("unregistered global request accepted")
+		}
+		if string(result.channelData) != "pushed" {
+			t.Errorf("push@test data = %q", result.channelData)
+		}
+		if !result.rejected {
+			t.Error("unregistered channel type not rejected")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not finish")
+	}
+}
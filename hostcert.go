@@ -0,0 +1,164 @@
+package gossh
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// 本文件实现了服务端主机证书的验证：主机证书由受信任的 CA 签发时，验证连接的主机名是否在证书的 principals 中、
+// 证书是否处于有效期内以及是否被吊销。CA 可以通过 known_hosts 中的 @cert-authority 记录或者直接给出的公钥指定
+
+// HostCertChecker 使用受信任的 CA 公钥验证服务端的主机证书
+type HostCertChecker struct {
+	Authorities []ssh.PublicKey              // 受信任的 CA 公钥，对所有主机有效
+	IsRevoked   func(key ssh.PublicKey) bool // 判断证书、证书中的主机公钥或者 CA 公钥是否已被吊销，可以为 nil
+	Fallback    HostKeyCallback              // 服务端提供的不是证书，或者证书不是由 Authorities 签发时使用，为 nil 时拒绝连接
+	Clock       func() time.Time             // 验证有效期时使用的时间，为 nil 时使用 time.Now
+	Logger      Logger                       // 记录验证结果，为 nil 时不记录
+}
+
+// NewHostCertCallback 生成一个仅信任由 authorities 签发的主机证书的 HostKeyCallback，
+// fallback 用于验证其它主机公钥，例如 NewKnownHostCallback 的返回值，为 nil 时拒绝连接
+func NewHostCertCallback(fallback HostKeyCallback, authorities ...ssh.PublicKey) HostKeyCallback {
+	return (&HostCertChecker{Authorities: authorities, Fallback: fallback}).Check
+}
+
+// LoadCertAuthorities 从 authorized_keys 格式（即 .pub 文件的格式）的文件中读取 CA 公钥，空行与 # 开头的注释将被忽略
+func LoadCertAuthorities(files ...string) ([]ssh.PublicKey, error) {
+	var authorities []ssh.PublicKey
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		n := len(authorities)
+		for len(data) > 0 {
+			key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+			if err != nil {
+				break
+			}
+			authorities = append(authorities, key)
+			data = rest
+		}
+		if len(authorities) == n {
+			return nil, fmt.Errorf("no public key found in %s", file)
+		}
+	}
+	return authorities, nil
+}
+
+// Check 验证服务端的主机证书，可作为 Config.HostKeyCallback。
+// 证书不是由 Authorities 签发且没有 Fallback 时返回 *HostKeyError，证书无效时返回的错误中包含原因
+func (c HostCertChecker) Check(hostname string, remote net.Addr, key PublicKey) error {
+	cert, ok := key.(*ssh.Certificate)
+	if !ok || !c.trusts(cert) {
+		if c.Fallback != nil {
+			return c.Fallback(hostname, remote, key)
+		}
+		reason := "not signed by a trusted certificate authority"
+		if !ok {
+			reason = "not a host certificate"
+		}
+		return &HostKeyError{Host: hostname, Remote: remote, Key: key, Err: errors.New(reason)}
+	}
+
+	checker := ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, address string) bool {
+			return containsKey(c.Authorities, auth)
+		},
+		IsRevoked: c.revoked,
+		Clock:     c.Clock,
+	}
+	if err := checker.CheckHostKey(hostname, remote, cert); err != nil {
+		c.logger().Log(LevelWarn, "host certificate rejected", "host", hostname, "key_id", cert.KeyId, "error", err)
+		return fmt.Errorf("host certificate %q of %s rejected: %w", cert.KeyId, hostname, err)
+	}
+	c.logger().Log(LevelDebug, "host certificate accepted", "host", hostname, "key_id", cert.KeyId, "serial", cert.Serial)
+	return nil
+}
+
+// trusts 证书是否由 Authorities 中的 CA 签发
+func (c HostCertChecker) trusts(cert *ssh.Certificate) bool {
+	return containsKey(c.Authorities, cert.SignatureKey)
+}
+
+// revoked 证书本身、证书中的主机公钥或者 CA 公钥被吊销时返回 true
+func (c HostCertChecker) revoked(cert *ssh.Certificate) bool {
+	if c.IsRevoked == nil {
+		return false
+	}
+	return c.IsRevoked(cert) || c.IsRevoked(cert.Key) || c.IsRevoked(cert.SignatureKey)
+}
+
+func (c HostCertChecker) logger() Logger {
+	if c.Logger == nil {
+		return NopLogger{}
+	}
+	return c.Logger
+}
+
+// noAuthorityPattern ssh.CertChecker 在没有为该主机签发证书的 CA 时返回的错误
+var noAuthorityPattern = regexp.MustCompile(`^ssh: no authorities for hostname`)
+
+// checkKnownHostsCert 使用 known_hosts 验证服务端提供的主机证书：证书本身、证书中的主机公钥或者 CA 公钥出现在 @revoked 记录中时
+// 返回 *knownhosts.RevokedError；证书由 Authorities 中的 CA 签发时使用 HostCertChecker 验证；由 @cert-authority 记录中的 CA 签发时由 callback 验证；
+// 否则与 Open-SSH 相同，使用证书中的主机公钥进行验证
+func (kw KnownHostsChecker) checkKnownHostsCert(callback ssh.HostKeyCallback, hostname string, remote net.Addr, cert *ssh.Certificate) error {
+	// knownhosts 只以证书本身判断吊销，因此直接与 @revoked 记录比较
+	revoked, err := kw.revokedKeys()
+	if err != nil {
+		return err
+	}
+	for _, key := range []ssh.PublicKey{cert, cert.Key, cert.SignatureKey} {
+		if known, ok := revoked[string(key.Marshal())]; ok {
+			return &knownhosts.RevokedError{Revoked: known}
+		}
+	}
+
+	checker := HostCertChecker{Authorities: kw.Authorities, Logger: kw.Logger}
+	if checker.trusts(cert) {
+		return checker.Check(hostname, remote, cert)
+	}
+	err = callback(hostname, remote, cert)
+	if err == nil || !noAuthorityPattern.MatchString(err.Error()) {
+		return err
+	}
+	return callback(hostname, remote, cert.Key)
+}
+
+// revokedKeys 读取所有存在的 known_hosts 文件中的 @revoked 记录，以公钥的 wire 格式作为键
+func (kw KnownHostsChecker) revokedKeys() (map[string]knownhosts.KnownKey, error) {
+	revoked := make(map[string]knownhosts.KnownKey)
+	for _, file := range kw.files {
+		f, err := os.Open(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		for line := 1; scanner.Scan(); line++ {
+			marker, _, key, _, _, err := ssh.ParseKnownHosts(scanner.Bytes())
+			if err != nil || marker != "revoked" {
+				continue
+			}
+			revoked[string(key.Marshal())] = knownhosts.KnownKey{Key: key, Filename: file, Line: line}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return revoked, nil
+}
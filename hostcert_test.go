@@ -0,0 +1,137 @@
+package gossh
+
+import (
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// newTestHostCert 使用 ca 为 principals 签发一个主机证书
+func newTestHostCert(t *testing.T, ca ssh.Signer, principals ...string) *ssh.Certificate {
+	t.Helper()
+	cert := &ssh.Certificate{
+		Key:             newTestSigner(t).PublicKey(),
+		KeyId:           "test-host",
+		CertType:        ssh.HostCert,
+		ValidPrincipals: principals,
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestHostCertChecker(t *testing.T) {
+	remote := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+	ca := newTestSigner(t)
+	cert := newTestHostCert(t, ca, "example.com")
+
+	checker := HostCertChecker{Authorities: []ssh.PublicKey{ca.PublicKey()}}
+	if err := checker.Check("example.com:22", remote, cert); err != nil {
+		t.Errorf("trusted certificate rejected: %v", err)
+	}
+	if err := checker.Check("other.example.com:22", remote, cert); err == nil {
+		t.Error("certificate accepted for a host outside its principals")
+	}
+	expired := newTestHostCert(t, ca, "example.com")
+	expired.ValidBefore = uint64(time.Now().Add(-time.Hour).Unix())
+	if err := expired.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	if err := checker.Check("example.com:22", remote, expired); err == nil {
+		t.Error("expired certificate accepted")
+	}
+	revoked := checker
+	revoked.IsRevoked = func(key ssh.PublicKey) bool { return string(key.Marshal()) == string(ca.PublicKey().Marshal()) }
+	if err := revoked.Check("example.com:22", remote, newTestHostCert(t, ca, "example.com")); err == nil {
+		t.Error("certificate signed by a revoked authority accepted")
+	}
+
+	// 不是证书或者不是由受信任的 CA 签发时交给 Fallback，没有 Fallback 时拒绝
+	var hostKeyErr *HostKeyError
+	if err := checker.Check("example.com:22", remote, newTestSigner(t).PublicKey()); !errors.As(err, &hostKeyErr) {
+		t.Errorf("plain host key: err = %v, want a *HostKeyError", err)
+	}
+	var fallback int
+	callback := NewHostCertCallback(func(hostname string, remote net.Addr, key PublicKey) error {
+		fallback++
+		return nil
+	}, ca.PublicKey())
+	if err := callback("example.com:22", remote, newTestHostCert(t, newTestSigner(t), "example.com")); err != nil || fallback != 1 {
+		t.Errorf("untrusted authority: err = %v, fallback called %d times", err, fallback)
+	}
+}
+
+func TestLoadCertAuthorities(t *testing.T) {
+	dir := t.TempDir()
+	ca1, ca2 := newTestSigner(t), newTestSigner(t)
+	file := filepath.Join(dir, "ca.pub")
+	content := "# host CAs\n\n" + authorizedKey(ca1.PublicKey()) + "\n" + authorizedKey(ca2.PublicKey()) + "\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	authorities, err := LoadCertAuthorities(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(authorities) != 2 || !containsKey(authorities, ca2.PublicKey()) {
+		t.Errorf("authorities = %v", authorities)
+	}
+
+	empty := filepath.Join(dir, "empty.pub")
+	if err := ioutil.WriteFile(empty, []byte("# nothing\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCertAuthorities(empty); err == nil {
+		t.Error("expected an error for a file without keys")
+	}
+}
+
+func TestKnownHostsCertificates(t *testing.T) {
+	const hostname = "127.0.0.1:2222"
+	remote := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2222}
+	ca := newTestSigner(t)
+	cert := newTestHostCert(t, ca, "127.0.0.1")
+	authority := "@cert-authority [127.0.0.1]:2222 " + authorizedKey(ca.PublicKey())
+
+	tests := []struct {
+		name        string
+		lines       []string
+		authorities []ssh.PublicKey
+		key         *ssh.Certificate
+		revoked     bool
+		wantErr     bool
+	}{
+		{name: "cert-authority", lines: []string{authority}, key: cert},
+		{name: "explicit authority", lines: []string{"# empty"}, authorities: []ssh.PublicKey{ca.PublicKey()}, key: cert},
+		{name: "revoked certificate", lines: []string{authority, "@revoked * " + authorizedKey(cert)}, key: cert, revoked: true, wantErr: true},
+		{name: "revoked certificate with explicit authority", lines: []string{"@revoked * " + authorizedKey(cert)},
+			authorities: []ssh.PublicKey{ca.PublicKey()}, key: cert, revoked: true, wantErr: true},
+		{name: "revoked host key", lines: []string{authority, "@revoked * " + authorizedKey(cert.Key)}, key: cert, revoked: true, wantErr: true},
+		{name: "revoked authority", lines: []string{"@revoked * " + authorizedKey(ca.PublicKey())},
+			authorities: []ssh.PublicKey{ca.PublicKey()}, key: cert, revoked: true, wantErr: true},
+		{name: "principal mismatch", lines: []string{authority}, key: newTestHostCert(t, ca, "other.example.com"), wantErr: true},
+		{name: "untrusted authority", lines: []string{authority}, key: newTestHostCert(t, newTestSigner(t), "127.0.0.1"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := KnownHostsChecker{files: []string{writeKnownHosts(t, tt.lines...)}, Authorities: tt.authorities}
+			err := checker.KnownHostsCheck(hostname, remote, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			var revokedErr *knownhosts.RevokedError
+			if errors.As(err, &revokedErr) != tt.revoked {
+				t.Errorf("err = %v, revoked %v", err, tt.revoked)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package gossh
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// 本文件实现了 Open-SSH 的 UpdateHostKeys：服务端通过 hostkeys-00@openssh.com 通告其全部主机公钥，
+// 客户端经由 hostkeys-prove-00@openssh.com 要求服务端证明持有新公钥对应的私钥后，将其写入 known_hosts，并移除服务端不再使用的公钥
+
+const (
+	HostKeysRequest      = "hostkeys-00@openssh.com"       // 服务端通告主机公钥的全局请求
+	HostKeysProveRequest = "hostkeys-prove-00@openssh.com" // 客户端要求服务端证明持有私钥的全局请求
+)
+
+// knownHostsMu 串行化对 known_hosts 文件的改写
+var knownHostsMu sync.Mutex
+
+// NewKnownHostsChecker 创建一个使用 files 作为 known_hosts 文件的 KnownHostsChecker，
+// 新的主机公钥将被写入 files 中的第一个文件
+func NewKnownHostsChecker(interactively bool, files ...string) *KnownHostsChecker {
+	return &KnownHostsChecker{
+		files:         files,
+		Interactively: interactively,
+	}
+}
+
+// UpdateHostKeys 处理服务端发送的 hostkeys-00@openssh.com 请求，可作为 GlobalRequestHandler 注册：
+//
+//	config.GlobalRequestHandlers = map[string]gossh.GlobalRequestHandler{gossh.HostKeysRequest: checker.UpdateHostKeys}
+//
+// 只有在本次连接的主机公钥已经记录于 known_hosts 中时才会更新：服务端通告的新公钥经过验证后被追加至第一个 known_hosts 文件，
+// 该文件中仅属于该主机且不再被服务端通告的公钥将被移除。任何一个新公钥验证失败时将放弃本次更新
+func (kw KnownHostsChecker) UpdateHostKeys(client *SSHClient, req *ssh.Request) (bool, []byte) {
+	keys, err := parseHostKeys(req.Payload)
+	if err != nil {
+		kw.logger().Log(LevelWarn, "invalid hostkeys request", "remote", client.RemoteAddr(), "error", err)
+		return false, nil
+	}
+	// 证明请求需要等待服务端回应，不阻塞全局请求的分发
+	go func() {
+		if err := kw.updateHostKeys(client, keys); err != nil {
+			kw.logger().Log(LevelWarn, "update host keys failed", "host", client.addr, "error", err)
+		}
+	}()
+	return true, nil
+}
+
+func (kw KnownHostsChecker) logger() Logger {
+	if kw.Logger == nil {
+		return NopLogger{}
+	}
+	return kw.Logger
+}
+
+func (kw KnownHostsChecker) updateHostKeys(client *SSHClient, advertised []ssh.PublicKey) error {
+	if len(kw.files) == 0 {
+		return errors.New("no known_hosts file given")
+	}
+	if client.hostKey == nil {
+		return errors.New("host key of the connection unknown")
+	}
+	hostname, remote := client.addr, client.RemoteAddr()
+
+	callback, err := knownhosts.New(kw.files...)
+	if err != nil {
+		return err
+	}
+	if err := callback(hostname, remote, client.hostKey); err != nil {
+		// 主机公钥未经 known_hosts 验证（例如被忽略或者交互式接受）时不进行更新
+		kw.logger().Log(LevelDebug, "host key not in known_hosts, skip updating", "host", hostname)
+		return nil
+	}
+
+	if !containsKey(advertised, client.hostKey) {
+		return errors.New("server did not advertise the host key used by the connection")
+	}
+
+	var newKeys []ssh.PublicKey
+	for _, key := range advertised {
+		err := callback(hostname, remote, key)
+		if err == nil {
+			continue
+		}
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			// 被吊销的公钥等情况
+			kw.logger().Log(LevelWarn, "ignore advertised host key", "host", hostname, "type", key.Type(), "error", err)
+			continue
+		}
+		newKeys = append(newKeys, key)
+	}
+
+	// 证明需要一次网络往返，在改写文件之前完成，以免持有 knownHostsMu 时等待服务端
+	if len(newKeys) > 0 {
+		if err := proveHostKeys(client, newKeys); err != nil {
+			return err
+		}
+	}
+
+	path := kw.files[0]
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// 等待证明期间其它连接可能已经记录了部分公钥
+	newKeys = missingHostKeys(content, hostname, newKeys)
+	kept, removed := removeStaleHostKeys(content, hostname, advertised)
+	if len(newKeys) == 0 && removed == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	buf.Write(kept)
+	if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	for _, key := range newKeys {
+		buf.WriteString(knownhosts.Line([]string{hostname}, key))
+		buf.WriteByte('\n')
+	}
+	if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+		return err
+	}
+	kw.logger().Log(LevelInfo, "host keys updated", "host", hostname, "file", path, "added", len(newKeys), "removed", removed)
+	return nil
+}
+
+// parseHostKeys 解析 hostkeys-00@openssh.com 请求中的主机公钥列表，无法识别的公钥类型将被忽略
+func parseHostKeys(payload []byte) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	for len(payload) > 0 {
+		blob, rest, ok := parseString(payload)
+		if !ok {
+			return nil, errors.New("malformed hostkeys payload")
+		}
+		payload = rest
+		key, err := ssh.ParsePublicKey(blob)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// proveHostKeys 要求服务端以 keys 对应的私钥对会话标识进行签名，并验证签名
+func proveHostKeys(client *SSHClient, keys []ssh.PublicKey) error {
+	var payload []byte
+	for _, key := range keys {
+		payload = append(payload, ssh.Marshal(struct{ Blob []byte }{key.Marshal()})...)
+	}
+	ok, reply, err := client.SendRequest(HostKeysProveRequest, true, payload)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("server refused to prove host keys")
+	}
+
+	sessionID := client.SessionID()
+	for i, key := range keys {
+		blob, rest, ok := parseString(reply)
+		if !ok {
+			return fmt.Errorf("missing signature for host key %d", i)
+		}
+		reply = rest
+
+		sig := new(ssh.Signature)
+		if err := ssh.Unmarshal(blob, sig); err != nil {
+			return fmt.Errorf("malformed signature for host key %d: %w", i, err)
+		}
+		data := ssh.Marshal(struct {
+			Type      string
+			SessionID []byte
+			Key       []byte
+		}{HostKeysProveRequest, sessionID, key.Marshal()})
+		if err := key.Verify(data, sig); err != nil {
+			return fmt.Errorf("signature verification failed for %s host key: %w", key.Type(), err)
+		}
+	}
+	return nil
+}
+
+// missingHostKeys 返回 keys 中 content 没有为 hostname 记录的公钥
+func missingHostKeys(content []byte, hostname string, keys []ssh.PublicKey) []ssh.PublicKey {
+	host := knownhosts.Normalize(hostname)
+	var recorded []ssh.PublicKey
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		marker, hosts, key, _, _, err := ssh.ParseKnownHosts(line)
+		if err != nil || marker != "" {
+			continue
+		}
+		for _, h := range hosts {
+			if knownHostMatches(h, host) {
+				recorded = append(recorded, key)
+				break
+			}
+		}
+	}
+	var missing []ssh.PublicKey
+	for _, key := range keys {
+		if !containsKey(recorded, key) {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// removeStaleHostKeys 移除 content 中仅属于 hostname 且不在 advertised 中的公钥，返回保留的内容以及移除的行数。
+// 包含多个主机、通配符或者带有 @cert-authority、@revoked 标记的行不会被改动
+func removeStaleHostKeys(content []byte, hostname string, advertised []ssh.PublicKey) ([]byte, int) {
+	host := knownhosts.Normalize(hostname)
+	var kept bytes.Buffer
+	removed := 0
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		marker, hosts, key, _, _, err := ssh.ParseKnownHosts(line)
+		if err == nil && marker == "" && len(hosts) == 1 && knownHostMatches(hosts[0], host) && !containsKey(advertised, key) {
+			removed++
+			continue
+		}
+		kept.Write(line)
+	}
+	return kept.Bytes(), removed
+}
+
+// knownHostMatches 判断 known_hosts 中的主机字段 entry（明文或 |1|salt|hash 形式）是否恰好为 host
+func knownHostMatches(entry, host string) bool {
+	if !strings.HasPrefix(entry, "|1|") {
+		return entry == host
+	}
+	parts := strings.Split(entry[len("|1|"):], "|")
+	if len(parts) != 2 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+func containsKey(keys []ssh.PublicKey, key ssh.PublicKey) bool {
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseString 解析 SSH 协议中的 string 类型
+func parseString(in []byte) (out, rest []byte, ok bool) {
+	if len(in) < 4 {
+		return nil, nil, false
+	}
+	length := uint32(in[0])<<24 | uint32(in[1])<<16 | uint32(in[2])<<8 | uint32(in[3])
+	in = in[4:]
+	if uint32(len(in)) < length {
+		return nil, nil, false
+	}
+	return in[:length], in[length:], true
+}
+
+// writeFileAtomic 以写入临时文件后重命名的方式替换 path 的内容，保留原文件的权限
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,203 @@
+package gossh
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// writeKnownHosts 将 lines 写入临时目录中的 known_hosts 文件
+func writeKnownHosts(t *testing.T, lines ...string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	if err := ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// authorizedKey 公钥的 authorized_keys 格式，不含换行
+func authorizedKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func TestRemoveStaleHostKeys(t *testing.T) {
+	const host = "[127.0.0.1]:2222"
+	current, stale, other := newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey()
+	content := strings.Join([]string{
+		host + " " + authorizedKey(current),
+		host + " " + authorizedKey(stale),
+		knownhosts.HashHostname(host) + " " + authorizedKey(stale),
+		host + ",alias " + authorizedKey(stale),
+		"@revoked " + host + " " + authorizedKey(stale),
+		"example.com " + authorizedKey(other),
+		"# comment",
+	}, "\n") + "\n"
+
+	kept, removed := removeStaleHostKeys([]byte(content), "127.0.0.1:2222", []ssh.PublicKey{current})
+	if removed != 2 {
+		t.Errorf("removed %d lines, want 2", removed)
+	}
+	want := strings.Join([]string{
+		host + " " + authorizedKey(current),
+		host + ",alias " + authorizedKey(stale),
+		"@revoked " + host + " " + authorizedKey(stale),
+		"example.com " + authorizedKey(other),
+		"# comment",
+	}, "\n") + "\n"
+	if string(kept) != want {
+		t.Errorf("kept:\n%s\nwant:\n%s", kept, want)
+	}
+}
+
+func TestMissingHostKeys(t *testing.T) {
+	const host = "[127.0.0.1]:2222"
+	recorded, hashed, revoked, missing := newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey()
+	content := strings.Join([]string{
+		host + " " + authorizedKey(recorded),
+		knownhosts.HashHostname(host) + " " + authorizedKey(hashed),
+		"@revoked " + host + " " + authorizedKey(revoked),
+		"example.com " + authorizedKey(missing),
+	}, "\n") + "\n"
+
+	got := missingHostKeys([]byte(content), "127.0.0.1:2222", []ssh.PublicKey{recorded, hashed, revoked, missing})
+	if len(got) != 2 || !containsKey(got, revoked) || !containsKey(got, missing) {
+		t.Errorf("missing %d keys, want the revoked and the unrecorded key", len(got))
+	}
+}
+
+func TestParseHostKeys(t *testing.T) {
+	a, b := newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey()
+	payload := ssh.Marshal(struct{ Blob []byte }{a.Marshal()})
+	payload = append(payload, ssh.Marshal(struct{ Blob []byte }{[]byte("unknown key type")})...)
+	payload = append(payload, ssh.Marshal(struct{ Blob []byte }{b.Marshal()})...)
+	keys, err := parseHostKeys(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || !containsKey(keys, a) || !containsKey(keys, b) {
+		t.Errorf("parsed %d keys", len(keys))
+	}
+	if _, err := parseHostKeys(payload[:len(payload)-1]); err == nil {
+		t.Error("expected an error for a truncated payload")
+	}
+}
+
+// startRotatingServer 启动一个以 current 作为主机私钥，并在握手后通告 current 与 next 两个主机公钥的测试服务端，
+// onProve 不为 nil 时在回应每个证明请求之前被调用
+func startRotatingServer(t *testing.T, current, next ssh.Signer, onProve func()) string {
+	t.Helper()
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(current)
+	return listenTestTCP(t, func(conn net.Conn) {
+		defer conn.Close()
+		serverConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			return
+		}
+		go func() {
+			for newChannel := range chans {
+				newChannel.Reject(ssh.Prohibited, "no channels")
+			}
+		}()
+		signers := map[string]ssh.Signer{string(current.PublicKey().Marshal()): current, string(next.PublicKey().Marshal()): next}
+		go func() {
+			for req := range reqs {
+				if req.Type != HostKeysProveRequest {
+					req.Reply(false, nil)
+					continue
+				}
+				if onProve != nil {
+					onProve()
+				}
+				var reply []byte
+				for payload := req.Payload; len(payload) > 0; {
+					blob, rest, _ := parseString(payload)
+					payload = rest
+					data := ssh.Marshal(struct {
+						Type      string
+						SessionID []byte
+						Key       []byte
+					}{HostKeysProveRequest, serverConn.SessionID(), blob})
+					sig, err := signers[string(blob)].Sign(rand.Reader, data)
+					if err != nil {
+						req.Reply(false, nil)
+						return
+					}
+					reply = append(reply, ssh.Marshal(struct{ Blob []byte }{ssh.Marshal(sig)})...)
+				}
+				req.Reply(true, reply)
+			}
+		}()
+
+		payload := ssh.Marshal(struct{ Blob []byte }{current.PublicKey().Marshal()})
+		payload = append(payload, ssh.Marshal(struct{ Blob []byte }{next.PublicKey().Marshal()})...)
+		serverConn.SendRequest(HostKeysRequest, false, payload)
+		serverConn.Wait()
+	})
+}
+
+func TestUpdateHostKeys(t *testing.T) {
+	current, next, stale := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	// 等待证明的回应时不应持有 knownHostsMu，否则其它连接无法改写 known_hosts
+	locked := make(chan bool, 1)
+	addr := startRotatingServer(t, current, next, func() {
+		acquired := make(chan struct{})
+		go func() {
+			knownHostsMu.Lock()
+			knownHostsMu.Unlock()
+			close(acquired)
+		}()
+		select {
+		case <-acquired:
+			locked <- false
+		case <-time.After(time.Second):
+			locked <- true
+		}
+	})
+	host := knownhosts.Normalize(addr)
+	file := writeKnownHosts(t,
+		host+" "+authorizedKey(current.PublicKey()),
+		host+" "+authorizedKey(stale.PublicKey()))
+
+	checker := NewKnownHostsChecker(false, file)
+	config := &Config{
+		User:                  "tester",
+		HostKeyCallback:       checker.KnownHostsCheck,
+		GlobalRequestHandlers: map[string]GlobalRequestHandler{HostKeysRequest: checker.UpdateHostKeys},
+	}
+	client, err := Connect(addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	want := host + " " + authorizedKey(current.PublicKey()) + "\n" + host + " " + authorizedKey(next.PublicKey()) + "\n"
+	var got string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		knownHostsMu.Lock()
+		data, _ := ioutil.ReadFile(file)
+		knownHostsMu.Unlock()
+		if got = string(data); got == want {
+			break
+		}
+	}
+	if got != want {
+		t.Errorf("known_hosts:\n%s\nwant:\n%s", got, want)
+	}
+	select {
+	case held := <-locked:
+		if held {
+			t.Error("knownHostsMu held while waiting for the host key proof")
+		}
+	default:
+		t.Error("host keys not proved")
+	}
+}
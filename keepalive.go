@@ -0,0 +1,123 @@
+package gossh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// 本文件实现了连接级别的 keepalive 以及对端失效检测
+
+// KeepAliveRequest Open-SSH 使用的 keepalive 全局请求类型，服务端即使不支持也会回应失败消息，因此可用于探测对端是否存活
+const KeepAliveRequest = "keepalive@openssh.com"
+
+var errKeepAliveTimeout = errors.New("keepalive reply timeout")
+
+// KeepAliveConfig 连接级别 keepalive 的配置
+type KeepAliveConfig struct {
+	Interval  time.Duration   // 发送 keepalive 请求的间隔，小于等于 0 时不发送
+	Timeout   time.Duration   // 等待单个请求回应的超时时间，为 0 时等于 Interval
+	MaxMissed int             // 连续未收到回应的次数达到该值时关闭连接，小于等于 0 时为 3
+	OnDead    func(err error) // 因 keepalive 无回应而关闭连接之前被调用，不应长时间阻塞
+}
+
+// Ping 发送一个 keepalive@openssh.com 全局请求，并在 timeout 内等待回应，返回请求的往返时间。
+// 无论服务端回应成功还是失败，都表明对端仍然存活。
+func (client *SSHClient) Ping(timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	reply := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest(KeepAliveRequest, true, nil)
+		reply <- err
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-reply:
+		if err != nil {
+			return 0, err
+		}
+		rtt := time.Since(start)
+		client.recordRTT(rtt)
+		return rtt, nil
+	case <-timer.C:
+		return 0, errKeepAliveTimeout
+	}
+}
+
+// KeepAlive 以 config.Interval 为间隔在连接上发送 keepalive@openssh.com 全局请求，并记录往返时间。
+// 连续 config.MaxMissed 个请求没有在 config.Timeout 内得到回应时，将调用 config.OnDead 并关闭连接。
+// 调用返回的 CancelFunc 或者连接关闭后停止发送。
+func (client *SSHClient) KeepAlive(config KeepAliveConfig) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	if config.Interval <= 0 {
+		return cancel
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = config.Interval
+	}
+	maxMissed := config.MaxMissed
+	if maxMissed <= 0 {
+		maxMissed = 3
+	}
+
+	go func() {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+		missed := 0
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-client.closed:
+				return
+			case <-ticker.C:
+				if _, err := client.Ping(timeout); err != nil {
+					missed++
+					if missed < maxMissed {
+						continue
+					}
+					deadErr := fmt.Errorf("peer is dead, %d keepalive requests missed: %w", missed, err)
+					if config.OnDead != nil {
+						config.OnDead(deadErr)
+					}
+					client.logger().Log(LevelWarn, "keepalive failed, closing connection", "remote", client.RemoteAddr(), "error", deadErr)
+					client.setCloseReason(deadErr)
+					client.Close()
+					return
+				}
+				missed = 0
+			}
+		}
+	}()
+	return cancel
+}
+
+// RTT 最近一次 keepalive 请求的往返时间，尚未测量时为 0
+func (client *SSHClient) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&client.rtt))
+}
+
+// SmoothedRTT 平滑后的往返时间，计算方式与 TCP 的 SRTT 相同（新样本权重为 1/8），尚未测量时为 0
+func (client *SSHClient) SmoothedRTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&client.srtt))
+}
+
+// recordRTT 记录一次往返时间的测量结果
+func (client *SSHClient) recordRTT(rtt time.Duration) {
+	atomic.StoreInt64(&client.rtt, int64(rtt))
+	for {
+		old := atomic.LoadInt64(&client.srtt)
+		srtt := int64(rtt)
+		if old != 0 {
+			srtt = old + (int64(rtt)-old)/8
+		}
+		if atomic.CompareAndSwapInt64(&client.srtt, old, srtt) {
+			return
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package gossh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// 32 位平台上 atomic 的 64 位操作要求地址按 8 字节对齐，只有结构体开头的字段能够得到保证
+func TestRTTFieldsAligned(t *testing.T) {
+	var client SSHClient
+	if offset := unsafe.Offsetof(client.rtt); offset != 0 {
+		t.Errorf("rtt offset = %d, want 0", offset)
+	}
+	if offset := unsafe.Offsetof(client.srtt); offset != 8 {
+		t.Errorf("srtt offset = %d, want 8", offset)
+	}
+}
+
+func TestRecordRTT(t *testing.T) {
+	var client SSHClient
+	client.recordRTT(80 * time.Millisecond)
+	if client.RTT() != 80*time.Millisecond || client.SmoothedRTT() != 80*time.Millisecond {
+		t.Fatalf("RTT = %s, SmoothedRTT = %s", client.RTT(), client.SmoothedRTT())
+	}
+	client.recordRTT(160 * time.Millisecond)
+	if client.RTT() != 160*time.Millisecond {
+		t.Errorf("RTT = %s, want 160ms", client.RTT())
+	}
+	if want := 90 * time.Millisecond; client.SmoothedRTT() != want {
+		t.Errorf("SmoothedRTT = %s, want %s", client.SmoothedRTT(), want)
+	}
+}
+
+// freezableConn 被冻结后读取将一直阻塞，直至连接被关闭，用于模拟无响应的对端
+type freezableConn struct {
+	net.Conn
+	frozen int32
+}
+
+func (c *freezableConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	for err == nil && atomic.LoadInt32(&c.frozen) == 1 {
+		// 丢弃冻结期间收到的数据
+		n, err = c.Conn.Read(b)
+	}
+	return n, err
+}
+
+func TestKeepAliveDetectsDeadPeer(t *testing.T) {
+	server := startTestServer(t)
+	var conn *freezableConn
+	config := testConfig(IgnoreHostKey)
+	config.Dialer = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		conn = &freezableConn{Conn: c}
+		return conn, nil
+	}
+	client, err := Connect(server.addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	rtt, err := client.Ping(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rtt <= 0 || client.RTT() != rtt {
+		t.Errorf("Ping = %s, RTT = %s", rtt, client.RTT())
+	}
+
+	dead := make(chan error, 1)
+	cancel := client.KeepAlive(KeepAliveConfig{
+		Interval:  20 * time.Millisecond,
+		MaxMissed: 2,
+		OnDead:    func(err error) { dead <- err },
+	})
+	defer cancel()
+	atomic.StoreInt32(&conn.frozen, 1)
+
+	select {
+	case err := <-dead:
+		if !errors.Is(err, errKeepAliveTimeout) {
+			t.Errorf("OnDead error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("dead peer not detected")
+	}
+	select {
+	case <-client.closed:
+	case <-time.After(time.Second):
+		t.Fatal("connection not closed after the peer is dead")
+	}
+}
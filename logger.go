@@ -0,0 +1,101 @@
+package gossh
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 本文件定义了库内部使用的日志接口，默认不输出任何日志
+
+// Level 日志级别
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// Logger 结构化的日志接口，keyvals 为交替出现的键与值，例如 Log(LevelInfo, "accept", "addr", addr)。
+// 实现需要能够被并发调用
+type Logger interface {
+	Log(level Level, msg string, keyvals ...interface{})
+}
+
+// LoggerFunc 将函数转换为 Logger，可用于适配 log、zap、logrus 等日志库
+type LoggerFunc func(level Level, msg string, keyvals ...interface{})
+
+func (f LoggerFunc) Log(level Level, msg string, keyvals ...interface{}) {
+	f(level, msg, keyvals...)
+}
+
+// NopLogger 丢弃所有日志，是未配置 Logger 时的默认值
+type NopLogger struct{}
+
+func (NopLogger) Log(Level, string, ...interface{}) {}
+
+// NewTextLogger 创建一个以 "时间 级别 消息 key=value ..." 格式将级别不低于 minLevel 的日志写入 w 的 Logger
+func NewTextLogger(w io.Writer, minLevel Level) Logger {
+	return &textLogger{w: w, minLevel: minLevel}
+}
+
+type textLogger struct {
+	mu       sync.Mutex
+	w        io.Writer
+	minLevel Level
+}
+
+func (l *textLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	if level < l.minLevel {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(time.Now().Format("2006-01-02T15:04:05.000Z07:00"))
+	b.WriteByte(' ')
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{} = "(MISSING)"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		fmt.Fprintf(&b, " %v=%v", keyvals[i], value)
+	}
+	b.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, b.String())
+}
+
+// loggerOf 返回 config 中配置的 Logger，未配置时返回 NopLogger
+func loggerOf(config *Config) Logger {
+	if config == nil || config.Logger == nil {
+		return NopLogger{}
+	}
+	return config.Logger
+}
+
+// logger 返回连接上配置的 Logger
+func (client *SSHClient) logger() Logger {
+	return loggerOf(client.config)
+}
@@ -0,0 +1,54 @@
+package gossh
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewTextLogger(&buf, LevelInfo)
+	logger.Log(LevelDebug, "hidden", "k", "v")
+	logger.Log(LevelWarn, "host key mismatch", "host", "example.com:22", "line", 3, "dangling")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1:\n%s", len(lines), buf.String())
+	}
+	fields := strings.SplitN(lines[0], " ", 2)
+	if len(fields) != 2 {
+		t.Fatalf("malformed line %q", lines[0])
+	}
+	if want := "WARN host key mismatch host=example.com:22 line=3 dangling=(MISSING)"; fields[1] != want {
+		t.Errorf("got %q, want %q", fields[1], want)
+	}
+}
+
+func TestConfigLogger(t *testing.T) {
+	server := startTestServer(t)
+	var mu sync.Mutex
+	var messages []string
+	config := testConfig(IgnoreHostKey)
+	config.Logger = LoggerFunc(func(level Level, msg string, keyvals ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		messages = append(messages, level.String()+" "+msg)
+	})
+	client, err := Connect(server.addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	found := false
+	for _, msg := range messages {
+		found = found || msg == "DEBUG ssh connection established"
+	}
+	if !found {
+		t.Errorf("messages = %q", messages)
+	}
+}
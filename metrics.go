@@ -0,0 +1,368 @@
+package gossh
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 本文件实现了连接以及端口转发的流量统计，并以 Prometheus 文本格式导出
+
+// ClientStats SSHClient 的统计信息
+type ClientStats struct {
+	BytesSent          uint64        // 传输层发送的字节数，包含 SSH 协议开销
+	BytesReceived      uint64        // 传输层接收的字节数，包含 SSH 协议开销
+	ChannelsOpened     uint64        // 打开的通道数（session、direct-tcpip、forwarded-tcpip 等）
+	ChannelsClosed     uint64        // 关闭的通道数
+	ForwardConnections uint64        // 经由远程端口转发（Listen）接受的连接数
+	RTT                time.Duration // 最近一次 keepalive 请求的往返时间
+	SmoothedRTT        time.Duration // 平滑后的往返时间
+}
+
+// clientMetrics SSHClient 的计数器，需要原子地访问
+type clientMetrics struct {
+	id                 uint64
+	bytesSent          uint64
+	bytesReceived      uint64
+	channelsOpened     uint64
+	channelsClosed     uint64
+	forwardConnections uint64
+}
+
+// Stats 返回连接的统计信息，只有 Config.Metrics 不为 nil 时才会进行计数，否则除 RTT 外均为 0
+func (client *SSHClient) Stats() ClientStats {
+	stats := ClientStats{RTT: client.RTT(), SmoothedRTT: client.SmoothedRTT()}
+	if m := client.metrics; m != nil {
+		stats.BytesSent = atomic.LoadUint64(&m.bytesSent)
+		stats.BytesReceived = atomic.LoadUint64(&m.bytesReceived)
+		stats.ChannelsOpened = atomic.LoadUint64(&m.channelsOpened)
+		stats.ChannelsClosed = atomic.LoadUint64(&m.channelsClosed)
+		stats.ForwardConnections = atomic.LoadUint64(&m.forwardConnections)
+	}
+	return stats
+}
+
+// ForwardStats 一个端口转发（Director 的一次 RedirectTo 或 DirectTcpTo 调用）的统计信息
+type ForwardStats struct {
+	Listen            string // 本地监听地址
+	Target            string // 转发的目标地址
+	Connections       uint64 // 接受的连接数
+	ActiveConnections int64  // 正在转发的连接数
+	BytesSent         uint64 // 由本地发送至目标的字节数
+	BytesReceived     uint64 // 由目标发送至本地的字节数
+}
+
+// forwardMetrics 端口转发的计数器，需要原子地访问
+type forwardMetrics struct {
+	listen, target    string
+	connections       uint64
+	activeConnections int64
+	bytesSent         uint64
+	bytesReceived     uint64
+}
+
+func (m *forwardMetrics) stats() ForwardStats {
+	return ForwardStats{
+		Listen:            m.listen,
+		Target:            m.target,
+		Connections:       atomic.LoadUint64(&m.connections),
+		ActiveConnections: atomic.LoadInt64(&m.activeConnections),
+		BytesSent:         atomic.LoadUint64(&m.bytesSent),
+		BytesReceived:     atomic.LoadUint64(&m.bytesReceived),
+	}
+}
+
+// track 统计一个被接受的本地连接，返回的连接关闭时转发结束；m 为 nil 时原样返回
+func (m *forwardMetrics) track(conn net.Conn) net.Conn {
+	if m == nil {
+		return conn
+	}
+	atomic.AddUint64(&m.connections, 1)
+	atomic.AddInt64(&m.activeConnections, 1)
+	return &countingConn{
+		Conn:  conn,
+		read:  &m.bytesSent,
+		write: &m.bytesReceived,
+		onClose: func() {
+			atomic.AddInt64(&m.activeConnections, -1)
+		},
+	}
+}
+
+// countingConn 统计读写字节数的连接
+type countingConn struct {
+	net.Conn
+	read, write *uint64
+	once        sync.Once
+	onClose     func()
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddUint64(c.read, uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(c.write, uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Close() error {
+	err := c.Conn.Close()
+	if c.onClose != nil {
+		c.once.Do(c.onClose)
+	}
+	return err
+}
+
+type hostUserKey struct {
+	addr, user string
+}
+
+// MetricsRegistry 收集注册了该 registry 的连接以及端口转发的统计信息，通过 Config.Metrics 启用。
+// MetricsRegistry 实现了 http.Handler，以 Prometheus 文本格式（version 0.0.4）输出所有指标。
+// 连接断开、端口转发结束后，其对应的指标将不再输出
+type MetricsRegistry struct {
+	mu           sync.Mutex
+	nextID       uint64
+	clients      map[*SSHClient]struct{}
+	forwards     map[*forwardMetrics]struct{}
+	connections  map[hostUserKey]uint64
+	authFailures map[hostUserKey]uint64
+}
+
+// NewMetricsRegistry 创建一个空的 MetricsRegistry
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		clients:      make(map[*SSHClient]struct{}),
+		forwards:     make(map[*forwardMetrics]struct{}),
+		connections:  make(map[hostUserKey]uint64),
+		authFailures: make(map[hostUserKey]uint64),
+	}
+}
+
+// instrumentConn 为即将进行握手的连接创建计数器
+func (r *MetricsRegistry) instrumentConn(conn net.Conn) (net.Conn, *clientMetrics) {
+	r.mu.Lock()
+	r.nextID++
+	m := &clientMetrics{id: r.nextID}
+	r.mu.Unlock()
+	return &countingConn{Conn: conn, read: &m.bytesReceived, write: &m.bytesSent}, m
+}
+
+// addClient 注册一个已经建立的连接
+func (r *MetricsRegistry) addClient(client *SSHClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients[client] = struct{}{}
+	r.connections[hostUserKey{client.addr, client.User()}]++
+}
+
+// removeClient 移除一个已经断开的连接
+func (r *MetricsRegistry) removeClient(client *SSHClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.clients, client)
+}
+
+// addForward 注册一个端口转发；r 为 nil 时返回 nil
+func (r *MetricsRegistry) addForward(listen, target string) *forwardMetrics {
+	if r == nil {
+		return nil
+	}
+	m := &forwardMetrics{listen: listen, target: target}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.forwards[m] = struct{}{}
+	return m
+}
+
+// removeForward 移除一个已经结束的端口转发
+func (r *MetricsRegistry) removeForward(m *forwardMetrics) {
+	if r == nil || m == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.forwards, m)
+}
+
+// Forwards 返回正在进行的端口转发的统计信息
+func (r *MetricsRegistry) Forwards() []ForwardStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := make([]ForwardStats, 0, len(r.forwards))
+	for m := range r.forwards {
+		stats = append(stats, m.stats())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Listen != stats[j].Listen {
+			return stats[i].Listen < stats[j].Listen
+		}
+		return stats[i].Target < stats[j].Target
+	})
+	return stats
+}
+
+// metricsObserver 将通道以及身份认证事件计入 registry
+type metricsObserver struct {
+	NopObserver
+	registry *MetricsRegistry
+}
+
+func (o metricsObserver) OnConnect(event ConnectEvent) {
+	if !errors.Is(event.Err, ErrAuthFailed) {
+		return
+	}
+	o.registry.mu.Lock()
+	defer o.registry.mu.Unlock()
+	o.registry.authFailures[hostUserKey{event.Addr, event.User}]++
+}
+
+func (o metricsObserver) OnChannelOpen(event ChannelEvent) {
+	if event.Err != nil || event.Client == nil || event.Client.metrics == nil {
+		return
+	}
+	atomic.AddUint64(&event.Client.metrics.channelsOpened, 1)
+	if event.Type == "forwarded-tcpip" {
+		atomic.AddUint64(&event.Client.metrics.forwardConnections, 1)
+	}
+}
+
+func (o metricsObserver) OnChannelClose(event ChannelEvent) {
+	if event.Client == nil || event.Client.metrics == nil {
+		return
+	}
+	atomic.AddUint64(&event.Client.metrics.channelsClosed, 1)
+}
+
+// ServeHTTP 以 Prometheus 文本格式输出所有指标
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WritePrometheus(w)
+}
+
+// WritePrometheus 以 Prometheus 文本格式将所有指标写入 w
+func (r *MetricsRegistry) WritePrometheus(w io.Writer) error {
+	type clientSample struct {
+		labels string
+		stats  ClientStats
+	}
+	type keySample struct {
+		labels string
+		value  uint64
+	}
+
+	r.mu.Lock()
+	clients := make([]clientSample, 0, len(r.clients))
+	for client := range r.clients {
+		labels := promLabels("id", fmt.Sprint(client.metrics.id), "addr", client.addr, "user", client.User())
+		clients = append(clients, clientSample{labels, client.Stats()})
+	}
+	keySamples := func(m map[hostUserKey]uint64) []keySample {
+		samples := make([]keySample, 0, len(m))
+		for key, value := range m {
+			samples = append(samples, keySample{promLabels("addr", key.addr, "user", key.user), value})
+		}
+		sort.Slice(samples, func(i, j int) bool { return samples[i].labels < samples[j].labels })
+		return samples
+	}
+	connections := keySamples(r.connections)
+	authFailures := keySamples(r.authFailures)
+	r.mu.Unlock()
+	forwards := r.Forwards()
+	sort.Slice(clients, func(i, j int) bool { return clients[i].labels < clients[j].labels })
+
+	bw := bufio.NewWriter(w)
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	metric("gossh_clients", "gauge", "Number of established SSH connections.")
+	fmt.Fprintf(bw, "gossh_clients %d\n", len(clients))
+
+	metric("gossh_connections_total", "counter", "Number of SSH connections established.")
+	for _, s := range connections {
+		fmt.Fprintf(bw, "gossh_connections_total%s %d\n", s.labels, s.value)
+	}
+	metric("gossh_auth_failures_total", "counter", "Number of SSH handshakes failed due to authentication.")
+	for _, s := range authFailures {
+		fmt.Fprintf(bw, "gossh_auth_failures_total%s %d\n", s.labels, s.value)
+	}
+
+	clientMetrics := []struct {
+		name, typ, help string
+		value           func(ClientStats) string
+	}{
+		{"gossh_client_bytes_sent_total", "counter", "Bytes sent on the SSH transport.",
+			func(s ClientStats) string { return fmt.Sprint(s.BytesSent) }},
+		{"gossh_client_bytes_received_total", "counter", "Bytes received on the SSH transport.",
+			func(s ClientStats) string { return fmt.Sprint(s.BytesReceived) }},
+		{"gossh_client_channels_opened_total", "counter", "Channels opened on the SSH connection.",
+			func(s ClientStats) string { return fmt.Sprint(s.ChannelsOpened) }},
+		{"gossh_client_channels_closed_total", "counter", "Channels closed on the SSH connection.",
+			func(s ClientStats) string { return fmt.Sprint(s.ChannelsClosed) }},
+		{"gossh_client_forward_connections_total", "counter", "Connections accepted by remote port forwarding.",
+			func(s ClientStats) string { return fmt.Sprint(s.ForwardConnections) }},
+		{"gossh_client_keepalive_rtt_seconds", "gauge", "Round-trip time of the last keepalive request.",
+			func(s ClientStats) string { return fmt.Sprint(s.RTT.Seconds()) }},
+		{"gossh_client_keepalive_srtt_seconds", "gauge", "Smoothed round-trip time of keepalive requests.",
+			func(s ClientStats) string { return fmt.Sprint(s.SmoothedRTT.Seconds()) }},
+	}
+	for _, m := range clientMetrics {
+		metric(m.name, m.typ, m.help)
+		for _, c := range clients {
+			fmt.Fprintf(bw, "%s%s %s\n", m.name, c.labels, m.value(c.stats))
+		}
+	}
+
+	forwardMetrics := []struct {
+		name, typ, help string
+		value           func(ForwardStats) string
+	}{
+		{"gossh_forward_connections_total", "counter", "Connections accepted by the port forward.",
+			func(s ForwardStats) string { return fmt.Sprint(s.Connections) }},
+		{"gossh_forward_active_connections", "gauge", "Connections currently being forwarded.",
+			func(s ForwardStats) string { return fmt.Sprint(s.ActiveConnections) }},
+		{"gossh_forward_bytes_sent_total", "counter", "Bytes forwarded from the local side to the target.",
+			func(s ForwardStats) string { return fmt.Sprint(s.BytesSent) }},
+		{"gossh_forward_bytes_received_total", "counter", "Bytes forwarded from the target to the local side.",
+			func(s ForwardStats) string { return fmt.Sprint(s.BytesReceived) }},
+	}
+	for _, m := range forwardMetrics {
+		metric(m.name, m.typ, m.help)
+		for _, f := range forwards {
+			fmt.Fprintf(bw, "%s%s %s\n", m.name, promLabels("listen", f.Listen, "target", f.Target), m.value(f))
+		}
+	}
+	return bw.Flush()
+}
+
+// promLabels 生成 Prometheus 标签集，kv 为交替出现的标签名与值
+func promLabels(kv ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(kv[i])
+		b.WriteString(`="`)
+		b.WriteString(promEscaper.Replace(kv[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,86 @@
+package gossh
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPromLabels(t *testing.T) {
+	got := promLabels("addr", "host:22", "user", "a\"b\\c\nd")
+	if want := `{addr="host:22",user="a\"b\\c\nd"}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// waitFor 在 timeout 内轮询直至 cond 返回 true
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMetricsRegistry(t *testing.T) {
+	server := startTestServer(t)
+	registry := NewMetricsRegistry()
+	config := testConfig(IgnoreHostKey)
+	config.Metrics = registry
+	client, err := Connect(server.addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := client.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.RunForOutput("counted"); err != nil {
+		t.Fatal(err)
+	}
+	session.Close()
+
+	waitFor(t, time.Second, func() bool { return client.Stats().ChannelsClosed == 1 })
+	stats := client.Stats()
+	if stats.BytesSent == 0 || stats.BytesReceived == 0 || stats.ChannelsOpened != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	failed := DefaultConfigAuthByPasswd("intruder", "wrong")
+	failed.Metrics = registry
+	if _, err := Connect(server.addr, failed); err == nil {
+		t.Fatal("expected an authentication error")
+	}
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"# TYPE gossh_clients gauge",
+		"gossh_clients 1",
+		fmt.Sprintf(`gossh_connections_total{addr="%s",user="tester"} 1`, server.addr),
+		fmt.Sprintf(`gossh_auth_failures_total{addr="%s",user="intruder"} 1`, server.addr),
+		"gossh_client_channels_opened_total{",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+
+	// 连接断开后不再输出该连接的指标
+	client.Close()
+	waitFor(t, time.Second, func() bool {
+		var buf bytes.Buffer
+		registry.WritePrometheus(&buf)
+		return strings.Contains(buf.String(), "gossh_clients 0\n")
+	})
+}
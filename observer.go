@@ -0,0 +1,393 @@
+package gossh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 本文件实现了 SSHClient 生命周期事件的观察者，可用于审计以及监控连接
+
+// ErrClosedByClient 连接由本端调用 Close 关闭
+var ErrClosedByClient = errors.New("connection closed by client")
+
+// AuthState 身份认证方法的状态
+type AuthState int
+
+const (
+	AuthTried     AuthState = iota // 开始尝试该方法
+	AuthSucceeded                  // 该方法认证成功，身份认证完成
+	AuthFailed                     // 身份认证失败，该方法被服务端拒绝或者未能完成身份认证
+)
+
+func (s AuthState) String() string {
+	switch s {
+	case AuthTried:
+		return "tried"
+	case AuthSucceeded:
+		return "succeeded"
+	case AuthFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("AuthState(%d)", int(s))
+}
+
+// ConnectEvent 连接建立的结果，Err 不为 nil 时表示建立失败，此时 Client 为 nil
+type ConnectEvent struct {
+	Addr   string
+	User   string
+	Client *SSHClient
+	Err    error
+}
+
+// HostKeyEvent 主机公钥验证的结果，Err 为 HostKeyCallback 的返回值
+type HostKeyEvent struct {
+	Hostname string
+	Remote   net.Addr
+	Key      PublicKey
+	Err      error
+}
+
+// AuthEvent 身份认证方法的状态变化，Method 为 password、publickey、keyboard-interactive 等方法名称。
+// 只有由 gossh 的函数（例如 PasswordAuth、AuthByPrivateKeys）生成的认证方法会产生该事件
+type AuthEvent struct {
+	Addr   string
+	User   string
+	Method string
+	State  AuthState
+}
+
+// ChannelEvent 通道的打开与关闭。Type 为通道类型；对于 direct-tcpip 与 forwarded-tcpip 通道，Addr 为转发的目标或来源地址。
+// 打开失败时 Err 不为 nil，且不会有对应的关闭事件
+type ChannelEvent struct {
+	Client *SSHClient
+	Type   string
+	Addr   string
+	Err    error
+}
+
+// ForwardEvent 远程端口转发（tcpip-forward）的开始与结束，开始失败时 Err 不为 nil
+type ForwardEvent struct {
+	Client  *SSHClient
+	Network string
+	Addr    string
+	Err     error
+}
+
+// DisconnectEvent 连接断开。Reason 为断开的原因：本端调用 Close 时为 ErrClosedByClient，
+// keepalive 检测到对端失效时为对应的错误，其余情况为 ssh.Conn.Wait 的返回值
+type DisconnectEvent struct {
+	Client *SSHClient
+	Addr   string
+	Reason error
+}
+
+// Observer 连接生命周期事件的观察者，通过 Config.Observer 注册。
+// 方法在产生事件的协程中被同步调用，不应长时间阻塞；只关心部分事件时可以嵌入 NopObserver
+type Observer interface {
+	OnConnect(event ConnectEvent)
+	OnHostKeyCheck(event HostKeyEvent)
+	OnAuth(event AuthEvent)
+	OnChannelOpen(event ChannelEvent)
+	OnChannelClose(event ChannelEvent)
+	OnForwardStart(event ForwardEvent)
+	OnForwardStop(event ForwardEvent)
+	OnDisconnect(event DisconnectEvent)
+}
+
+// NopObserver 忽略所有事件的 Observer
+type NopObserver struct{}
+
+func (NopObserver) OnConnect(ConnectEvent)       {}
+func (NopObserver) OnHostKeyCheck(HostKeyEvent)  {}
+func (NopObserver) OnAuth(AuthEvent)             {}
+func (NopObserver) OnChannelOpen(ChannelEvent)   {}
+func (NopObserver) OnChannelClose(ChannelEvent)  {}
+func (NopObserver) OnForwardStart(ForwardEvent)  {}
+func (NopObserver) OnForwardStop(ForwardEvent)   {}
+func (NopObserver) OnDisconnect(DisconnectEvent) {}
+
+// observerOf 返回 config 中注册的 Observer，启用了 Config.Metrics 时将一并通知 MetricsRegistry，都未注册时返回 NopObserver
+func observerOf(config *Config) Observer {
+	if config == nil {
+		return NopObserver{}
+	}
+	switch {
+	case config.Metrics == nil && config.Observer == nil:
+		return NopObserver{}
+	case config.Metrics == nil:
+		return config.Observer
+	case config.Observer == nil:
+		return metricsObserver{registry: config.Metrics}
+	}
+	return multiObserver{config.Observer, metricsObserver{registry: config.Metrics}}
+}
+
+// observing config 中是否注册了需要接收事件的 Observer 或 MetricsRegistry
+func observing(config *Config) bool {
+	return config != nil && (config.Observer != nil || config.Metrics != nil)
+}
+
+// multiObserver 依次通知多个 Observer
+type multiObserver []Observer
+
+func (m multiObserver) OnConnect(event ConnectEvent) {
+	for _, o := range m {
+		o.OnConnect(event)
+	}
+}
+
+func (m multiObserver) OnHostKeyCheck(event HostKeyEvent) {
+	for _, o := range m {
+		o.OnHostKeyCheck(event)
+	}
+}
+
+func (m multiObserver) OnAuth(event AuthEvent) {
+	for _, o := range m {
+		o.OnAuth(event)
+	}
+}
+
+func (m multiObserver) OnChannelOpen(event ChannelEvent) {
+	for _, o := range m {
+		o.OnChannelOpen(event)
+	}
+}
+
+func (m multiObserver) OnChannelClose(event ChannelEvent) {
+	for _, o := range m {
+		o.OnChannelClose(event)
+	}
+}
+
+func (m multiObserver) OnForwardStart(event ForwardEvent) {
+	for _, o := range m {
+		o.OnForwardStart(event)
+	}
+}
+
+func (m multiObserver) OnForwardStop(event ForwardEvent) {
+	for _, o := range m {
+		o.OnForwardStop(event)
+	}
+}
+
+func (m multiObserver) OnDisconnect(event DisconnectEvent) {
+	for _, o := range m {
+		o.OnDisconnect(event)
+	}
+}
+
+// observer 返回连接上注册的 Observer
+func (client *SSHClient) observer() Observer {
+	return observerOf(client.config)
+}
+
+// observed 连接上是否注册了 Observer 或 MetricsRegistry，都未注册时通道、连接以及监听器不会被包装
+func (client *SSHClient) observed() bool {
+	return observing(client.config)
+}
+
+// authTracker 记录一次握手中被尝试的身份认证方法，并在握手结束后报告结果
+type authTracker struct {
+	observer Observer // 为 nil 时只记录，不报告事件
+	addr     string
+	user     string
+
+	untracked bool // 存在不是由 gossh 构造的认证方法，无法得知其是否被尝试
+
+	mu    sync.Mutex
+	tried []string
+}
+
+// wrap 替换 methods 中由 gossh 构造的认证方法，以便在方法被尝试时得到通知。
+// ssh 包中的认证方法无法从外部拦截，其它方法将原样返回，不会产生 AuthTried 事件
+func (t *authTracker) wrap(methods []ssh.AuthMethod) []ssh.AuthMethod {
+	wrapped := make([]ssh.AuthMethod, 0, len(methods))
+	for _, method := range methods {
+		m, ok := method.(*authMethod)
+		if !ok {
+			t.untracked = true
+			wrapped = append(wrapped, method)
+			continue
+		}
+		name := m.name
+		wrapped = append(wrapped, m.observe(func() { t.attempt(name) }))
+	}
+	return wrapped
+}
+
+// attempt 记录一次尝试
+func (t *authTracker) attempt(name string) {
+	t.mu.Lock()
+	t.tried = append(t.tried, name)
+	t.mu.Unlock()
+	if t.observer != nil {
+		t.observer.OnAuth(AuthEvent{Addr: t.addr, User: t.user, Method: name, State: AuthTried})
+	}
+}
+
+// methods 被尝试的方法名称，按照第一次尝试的顺序排列，不含重复
+func (t *authTracker) methods() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var methods []string
+	for _, name := range t.tried {
+		if !containsString(methods, name) {
+			methods = append(methods, name)
+		}
+	}
+	return methods
+}
+
+// finish 在握手结束后报告被尝试的方法的结果。握手失败时所有被尝试的方法均为失败；
+// 握手成功时只有最后一次尝试确定是成功的，之前的尝试可能被拒绝，也可能是服务端要求多个方法时的部分成功，无法区分，因此不报告其结果。
+// 存在不是由 gossh 构造的认证方法时，最后一次被记录的尝试之后可能还有未被记录的尝试，此时不报告成功
+func (t *authTracker) finish(err error) {
+	if t.observer == nil {
+		return
+	}
+	t.mu.Lock()
+	tried := t.tried
+	t.mu.Unlock()
+	if err == nil {
+		if len(tried) > 0 && !t.untracked {
+			t.observer.OnAuth(AuthEvent{Addr: t.addr, User: t.user, Method: tried[len(tried)-1], State: AuthSucceeded})
+		}
+		return
+	}
+	for _, name := range tried {
+		t.observer.OnAuth(AuthEvent{Addr: t.addr, User: t.user, Method: name, State: AuthFailed})
+	}
+}
+
+// observeHostKeyCallback 包装主机公钥验证回调，报告验证结果
+func observeHostKeyCallback(observer Observer, callback ssh.HostKeyCallback) ssh.HostKeyCallback {
+	if callback == nil {
+		return nil
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		observer.OnHostKeyCheck(HostKeyEvent{Hostname: hostname, Remote: remote, Key: key, Err: err})
+		return err
+	}
+}
+
+// setCloseReason 记录连接断开的原因，只有第一次记录的原因有效
+func (client *SSHClient) setCloseReason(reason error) {
+	client.reasonMu.Lock()
+	defer client.reasonMu.Unlock()
+	if client.reason == nil {
+		client.reason = reason
+	}
+}
+
+// disconnectReason 连接断开的原因，没有记录时为 waitErr
+func (client *SSHClient) disconnectReason(waitErr error) error {
+	client.reasonMu.Lock()
+	defer client.reasonMu.Unlock()
+	if client.reason != nil {
+		return client.reason
+	}
+	return waitErr
+}
+
+// observedChannel 关闭时报告 ChannelClose 事件的通道
+type observedChannel struct {
+	ssh.Channel
+	once  sync.Once
+	close func()
+}
+
+func (c *observedChannel) Close() error {
+	err := c.Channel.Close()
+	c.once.Do(c.close)
+	return err
+}
+
+// observedConn 关闭时报告 ChannelClose 事件的 direct-tcpip 或 forwarded-tcpip 连接
+type observedConn struct {
+	net.Conn
+	once  sync.Once
+	close func()
+}
+
+func (c *observedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.close)
+	return err
+}
+
+// observeDial 报告经由 Dial 打开的 direct-tcpip 通道
+func (client *SSHClient) observeDial(conn net.Conn, err error, network, addr string) (net.Conn, error) {
+	if err != nil {
+		if client.observed() {
+			client.observer().OnChannelOpen(ChannelEvent{Client: client, Type: channelTypeOf(network), Addr: addr, Err: err})
+		}
+		return nil, err
+	}
+	return client.observeConn(conn, channelTypeOf(network), addr), nil
+}
+
+// channelTypeOf 经由 Dial 连接 network 时所打开的通道类型
+func channelTypeOf(network string) string {
+	if network == "unix" {
+		return "direct-streamlocal@openssh.com"
+	}
+	return "direct-tcpip"
+}
+
+// observeConn 报告 conn 的打开，并在其关闭时报告关闭
+func (client *SSHClient) observeConn(conn net.Conn, channelType, addr string) net.Conn {
+	if !client.observed() {
+		return conn
+	}
+	observer := client.observer()
+	event := ChannelEvent{Client: client, Type: channelType, Addr: addr}
+	observer.OnChannelOpen(event)
+	return &observedConn{Conn: conn, close: func() {
+		observer.OnChannelClose(event)
+	}}
+}
+
+// observedListener 远程端口转发的监听器，接受的连接以及监听器的关闭都将被报告
+type observedListener struct {
+	net.Listener
+	client  *SSHClient
+	network string
+	once    sync.Once
+}
+
+func (l *observedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.client.observeConn(conn, "forwarded-tcpip", conn.RemoteAddr().String()), nil
+}
+
+func (l *observedListener) Close() error {
+	err := l.Listener.Close()
+	l.once.Do(func() {
+		l.client.observer().OnForwardStop(ForwardEvent{Client: l.client, Network: l.network, Addr: l.Addr().String()})
+	})
+	return err
+}
+
+// observeListener 报告远程端口转发的开始，并在监听器关闭时报告结束
+func (client *SSHClient) observeListener(listener net.Listener, err error, network, addr string) (net.Listener, error) {
+	if !client.observed() {
+		return listener, err
+	}
+	observer := client.observer()
+	if err != nil {
+		observer.OnForwardStart(ForwardEvent{Client: client, Network: network, Addr: addr, Err: err})
+		return nil, err
+	}
+	observer.OnForwardStart(ForwardEvent{Client: client, Network: network, Addr: listener.Addr().String()})
+	return &observedListener{Listener: listener, client: client, network: network}, nil
+}
@@ -0,0 +1,160 @@
+package gossh
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// recordingObserver 以文本形式按顺序记录收到的事件
+type recordingObserver struct {
+	mu     sync.Mutex
+	events []string
+	done   chan struct{} // 收到 OnDisconnect 后被关闭
+}
+
+func newRecordingObserver() *recordingObserver {
+	return &recordingObserver{done: make(chan struct{})}
+}
+
+func (o *recordingObserver) add(format string, args ...interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, fmt.Sprintf(format, args...))
+}
+
+func (o *recordingObserver) list() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string(nil), o.events...)
+}
+
+func (o *recordingObserver) OnConnect(e ConnectEvent) { o.add("connect err=%v", e.Err != nil) }
+func (o *recordingObserver) OnHostKeyCheck(e HostKeyEvent) {
+	o.add("hostkey err=%v", e.Err != nil)
+}
+func (o *recordingObserver) OnAuth(e AuthEvent) { o.add("auth %s %s", e.Method, e.State) }
+func (o *recordingObserver) OnChannelOpen(e ChannelEvent) {
+	o.add("open %s err=%v", e.Type, e.Err != nil)
+}
+func (o *recordingObserver) OnChannelClose(e ChannelEvent) { o.add("close %s", e.Type) }
+func (o *recordingObserver) OnForwardStart(e ForwardEvent) { o.add("forward start %s", e.Network) }
+func (o *recordingObserver) OnForwardStop(e ForwardEvent)  { o.add("forward stop %s", e.Network) }
+func (o *recordingObserver) OnDisconnect(e DisconnectEvent) {
+	o.add("disconnect closed-by-client=%v", errors.Is(e.Reason, ErrClosedByClient))
+	close(o.done)
+}
+
+func TestObserverEvents(t *testing.T) {
+	server := startTestServer(t)
+	observer := newRecordingObserver()
+	config := testConfig(IgnoreHostKey)
+	config.Observer = observer
+	client, err := Connect(server.addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := client.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.RunForOutput("observed"); err != nil {
+		t.Fatal(err)
+	}
+	session.Close()
+	// 测试服务端拒绝 direct-tcpip 以外的未知通道
+	if _, _, err := client.OpenChannel("unknown@test", nil); err == nil {
+		t.Error("expected the unknown channel to be rejected")
+	}
+	client.Close()
+	select {
+	case <-observer.done:
+	case <-time.After(time.Second):
+		t.Fatal("no disconnect event")
+	}
+
+	want := []string{
+		"hostkey err=false",
+		"auth password tried",
+		"auth password succeeded",
+		"connect err=false",
+		"open session err=false",
+		"close session",
+		"open unknown@test err=true",
+		"disconnect closed-by-client=true",
+	}
+	got := observer.list()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestObserverAuthAttempts(t *testing.T) {
+	server := startTestServer(t)
+	_, signer := newTestPrivateKey(t)
+	tests := []struct {
+		name string
+		auth []AuthMethod
+		want []string
+	}{
+		// 被拒绝的 publickey 之后 password 认证成功，之前的尝试无法区分被拒绝与部分成功，不报告其结果
+		{
+			name: "fallback",
+			auth: []AuthMethod{publicKeysAuth(signer), RetryableAuthMethod(PasswordAuth(testPassword), 2)},
+			want: []string{"auth publickey tried", "auth password tried", "auth password succeeded"},
+		},
+		// 无法得知 ssh 包中的认证方法是否被尝试，不能确定成功的方法
+		{
+			name: "untracked",
+			auth: []AuthMethod{publicKeysAuth(signer), ssh.Password(testPassword)},
+			want: []string{"auth publickey tried"},
+		},
+		{
+			name: "rejected",
+			auth: []AuthMethod{PasswordAuth("wrong")},
+			want: []string{"auth password tried", "auth password failed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observer := newRecordingObserver()
+			config := &Config{User: "tester", Auth: tt.auth, HostKeyCallback: IgnoreHostKey, Observer: observer}
+			if client, err := Connect(server.addr, config); err == nil {
+				client.Close()
+			}
+			var got []string
+			for _, event := range observer.list() {
+				if strings.HasPrefix(event, "auth ") {
+					got = append(got, event)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObserverConnectFailure(t *testing.T) {
+	server := startTestServer(t)
+	observer := newRecordingObserver()
+	config := DefaultConfigAuthByPasswd("tester", "wrong")
+	config.Observer = observer
+	if _, err := Connect(server.addr, config); err == nil {
+		t.Fatal("expected an authentication error")
+	}
+	got := observer.list()
+	if len(got) == 0 || got[len(got)-1] != "connect err=true" {
+		t.Errorf("events = %q, want a failed connect last", got)
+	}
+	for _, event := range got {
+		if event == "auth password succeeded" {
+			t.Errorf("events = %q", got)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package gossh
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// 本文件实现了对加密私钥的支持：解析私钥时如果需要口令，将通过 PassphraseProvider 获取口令。
+// 解密后的 Signer 只由使用它的认证方法持有，不在认证方法之间共享，每次解密都需要由 provider 给出正确的口令
+
+// ErrIncorrectPassphrase 私钥的口令错误
+var ErrIncorrectPassphrase = x509.IncorrectPasswordError
+
+// PassphraseProvider 返回加密私钥的口令，file 为私钥文件的路径，直接给出私钥内容时为空
+type PassphraseProvider func(file string) ([]byte, error)
+
+// PassphraseFromTerminal 从终端读取口令，提示信息被写入标准错误输出
+func PassphraseFromTerminal() PassphraseProvider {
+	return func(file string) ([]byte, error) {
+		if file != "" {
+			fmt.Fprintf(os.Stderr, "Enter passphrase for key '%s': ", file)
+		} else {
+			fmt.Fprint(os.Stderr, "Enter passphrase for key: ")
+		}
+		passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("read passphrase failed: %s", err)
+		}
+		return passphrase, nil
+	}
+}
+
+// PassphraseFromEnv 从环境变量 name 中读取口令，环境变量未设置时返回错误
+func PassphraseFromEnv(name string) PassphraseProvider {
+	return func(file string) ([]byte, error) {
+		passphrase, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", name)
+		}
+		return []byte(passphrase), nil
+	}
+}
+
+// PassphraseFromFile 从文件 path 中读取口令，文件末尾的换行符将被去除
+func PassphraseFromFile(path string) PassphraseProvider {
+	return func(file string) ([]byte, error) {
+		passphrase, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimRight(passphrase, "\r\n"), nil
+	}
+}
+
+// StaticPassphrase 总是返回给定的口令
+func StaticPassphrase(passphrase string) PassphraseProvider {
+	return func(file string) ([]byte, error) {
+		return []byte(passphrase), nil
+	}
+}
+
+// AuthByPrivateKeysFromPathsWithPassphrase 与 AuthByPrivateKeysFromPaths 相同，私钥被加密时通过 provider 获取口令。
+// provider 为 nil 时遇到加密的私钥将返回 *ssh.PassphraseMissingError
+func AuthByPrivateKeysFromPathsWithPassphrase(provider PassphraseProvider, files ...string) (AuthMethod, error) {
+	var signers []ssh.Signer
+	for _, file := range files {
+		key, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := parsePrivateKey(key, file, provider)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+	return publicKeysAuth(signers...), nil
+}
+
+// AuthByPrivateKeysWithPassphrase 与 AuthByPrivateKeys 相同，私钥被加密时通过 provider 获取口令
+func AuthByPrivateKeysWithPassphrase(provider PassphraseProvider, keys ...[]byte) (AuthMethod, error) {
+	var signers []ssh.Signer
+	for _, key := range keys {
+		signer, err := parsePrivateKey(key, "", provider)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+	return publicKeysAuth(signers...), nil
+}
+
+// parsePrivateKey 解析私钥，需要口令时通过 provider 获取口令
+func parsePrivateKey(key []byte, file string, provider PassphraseProvider) (ssh.Signer, error) {
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if err == nil || !errors.As(err, &missing) || provider == nil {
+		return signer, err
+	}
+
+	passphrase, err := provider(file)
+	if err != nil {
+		return nil, fmt.Errorf("get passphrase for %s: %w", keyName(file), err)
+	}
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: %w", keyName(file), err)
+	}
+	return signer, nil
+}
+
+// keyName 用于错误信息的私钥名称
+func keyName(file string) string {
+	if file == "" {
+		return "private key"
+	}
+	return "private key " + file
+}
@@ -0,0 +1,63 @@
+package gossh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+// encryptTestKey 使用 passphrase 加密 newTestPrivateKey 生成的 PEM 私钥
+func encryptTestKey(t *testing.T, key []byte, passphrase string) []byte {
+	t.Helper()
+	block, _ := pem.Decode(key)
+	//lint:ignore SA1019 Open-SSH 的旧格式加密私钥，仅用于测试
+	encrypted, err := x509.EncryptPEMBlock(rand.Reader, block.Type, block.Bytes, []byte(passphrase), x509.PEMCipherAES128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(encrypted)
+}
+
+func TestAuthByPrivateKeysWithPassphrase(t *testing.T) {
+	key, signer := newTestPrivateKey(t)
+	encrypted := encryptTestKey(t, key, "pass")
+
+	if _, err := AuthByPrivateKeysWithPassphrase(nil, encrypted); err == nil {
+		t.Error("expected an error without a passphrase provider")
+	}
+	if _, err := AuthByPrivateKeysWithPassphrase(StaticPassphrase("wrong"), encrypted); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Errorf("err = %v, want ErrIncorrectPassphrase", err)
+	}
+
+	var asked int
+	provider := func(file string) ([]byte, error) {
+		asked++
+		return []byte("pass"), nil
+	}
+	if _, err := AuthByPrivateKeysWithPassphrase(provider, encrypted); err != nil {
+		t.Fatal(err)
+	}
+	if asked != 1 {
+		t.Errorf("passphrase asked %d times, want 1", asked)
+	}
+
+	// 解密结果不在认证方法之间共享，之前成功解密过的私钥同样需要正确的口令
+	if _, err := AuthByPrivateKeysWithPassphrase(StaticPassphrase("wrong"), encrypted); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Errorf("err = %v after a successful decryption, want ErrIncorrectPassphrase", err)
+	}
+	if _, err := AuthByPrivateKeysWithPassphrase(nil, encrypted); err == nil {
+		t.Error("expected an error without a passphrase provider after a successful decryption")
+	}
+
+	// 未加密的私钥不需要口令
+	parsed, err := parsePrivateKey(key, "", func(string) ([]byte, error) {
+		t.Error("passphrase asked for an unencrypted key")
+		return nil, nil
+	})
+	if err != nil || !bytes.Equal(parsed.PublicKey().Marshal(), signer.PublicKey().Marshal()) {
+		t.Errorf("parsePrivateKey = %v, %v", parsed, err)
+	}
+}
@@ -0,0 +1,397 @@
+package gossh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 本文件实现了以 user@addr 以及配置指纹为键的 SSHClient 连接池
+
+const (
+	// DefaultMaxSessions 单个连接上同时打开的 session 数量上限，与 Open-SSH 服务端 MaxSessions 的默认值相同
+	DefaultMaxSessions = 10
+	// DefaultPoolIdleTimeout 连接池中没有打开任何 session 的连接被关闭前的默认空闲时间
+	DefaultPoolIdleTimeout = 5 * time.Minute
+)
+
+// PoolOptions ClientPool 的选项
+type PoolOptions struct {
+	MaxSessionsPerClient int           // 单个连接上同时打开的 session 数量上限，小于等于 0 时使用 DefaultMaxSessions
+	MaxClientsPerKey     int           // 同一个键下的最大连接数，达到上限后 OpenSession 将等待其他 session 关闭，小于等于 0 时不做限制
+	IdleTimeout          time.Duration // 没有打开任何 session 的连接被关闭前的空闲时间，为 0 时使用 DefaultPoolIdleTimeout
+	CleanupInterval      time.Duration // 检查空闲连接的间隔，为 0 时为 IdleTimeout 的一半
+}
+
+// PoolStats 连接池统计信息
+type PoolStats struct {
+	Clients        int    // 当前缓存的连接数
+	ActiveSessions int    // 当前通过连接池打开且尚未关闭的 session 数
+	Dials          uint64 // 建立新连接的次数
+	DialErrors     uint64 // 建立新连接失败的次数
+	Hits           uint64 // 复用已有连接打开 session 的次数
+	Evictions      uint64 // 因空闲、断开或连接池关闭而被移除的连接数
+}
+
+// ClientPool 缓存并复用与同一目标、以同一配置建立的 SSHClient，并在连接上分配 session。
+// 配置以内容比较，无需共用同一个 *Config 实例；其中的回调函数（例如 HostKeyCallback）以及不是由 gossh 构造的身份认证方法无法比较内容，
+// 只有同一个函数或实例才被视为相同。连接断开后将被移出连接池，空闲超过 IdleTimeout 的连接将被关闭。
+type ClientPool struct {
+	opts PoolOptions
+
+	mu      sync.Mutex
+	clients map[string][]*pooledClient
+	dialing map[string]int // 正在建立的连接数
+	waiting map[string]int // 等待正在建立的连接的 OpenSession 数
+	release chan struct{}  // 有 session 关闭或连接被移除时被关闭并替换，用于唤醒等待的 OpenSession
+	stats   PoolStats
+	closed  bool
+	stop    chan struct{}
+}
+
+// pooledClient 连接池中的一个连接
+type pooledClient struct {
+	client   *SSHClient
+	key      string
+	sessions int
+	limit    int
+	lastUsed time.Time
+	dead     bool
+}
+
+var errPoolClosed = errors.New("client pool closed")
+
+// NewClientPool 创建一个连接池，并启动空闲连接的清理
+func NewClientPool(opts PoolOptions) *ClientPool {
+	if opts.MaxSessionsPerClient <= 0 {
+		opts.MaxSessionsPerClient = DefaultMaxSessions
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultPoolIdleTimeout
+	}
+	if opts.CleanupInterval <= 0 {
+		opts.CleanupInterval = opts.IdleTimeout / 2
+	}
+
+	p := &ClientPool{
+		opts:    opts,
+		clients: make(map[string][]*pooledClient),
+		dialing: make(map[string]int),
+		waiting: make(map[string]int),
+		release: make(chan struct{}),
+		stop:    make(chan struct{}),
+	}
+	go p.cleanup()
+	return p
+}
+
+// OpenSession 从连接池中选取一个 session 数量未达上限的连接并打开一个 session，没有可用连接时将建立新的连接。
+// 返回的 Session 必须被关闭，以便将其占用的名额归还给连接池。
+// 服务端以 administratively prohibited 拒绝打开 session 时，将认为该连接已经达到服务端的 MaxSessions 限制并降低其上限。
+func (p *ClientPool) OpenSession(ctx context.Context, addr string, config *Config) (*Session, error) {
+	if config == nil {
+		return nil, errors.New("invalid config")
+	}
+	key := poolKey(addr, config)
+
+	for {
+		pc, err := p.acquire(ctx, key, addr, config)
+		if err != nil {
+			return nil, err
+		}
+
+		sess, err := pc.client.OpenSession()
+		if err != nil {
+			var openErr *ssh.OpenChannelError
+			prohibited := errors.As(err, &openErr) && openErr.Reason == ssh.Prohibited
+			p.mu.Lock()
+			retry := prohibited && pc.sessions > 1
+			if retry {
+				pc.limit = pc.sessions - 1
+			}
+			p.mu.Unlock()
+			p.releaseSession(pc)
+			if retry {
+				continue
+			}
+			return nil, err
+		}
+
+		var once sync.Once
+		onClose := sess.onClose
+		sess.onClose = func() {
+			once.Do(func() {
+				p.releaseSession(pc)
+			})
+			if onClose != nil {
+				onClose()
+			}
+		}
+		return sess, nil
+	}
+}
+
+// acquire 在 key 对应的连接中占用一个 session 名额，必要时建立新的连接
+func (p *ClientPool) acquire(ctx context.Context, key, addr string, config *Config) (*pooledClient, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, errPoolClosed
+		}
+		for _, pc := range p.clients[key] {
+			if !pc.dead && pc.sessions < pc.limit {
+				pc.sessions++
+				pc.lastUsed = time.Now()
+				p.stats.ActiveSessions++
+				p.stats.Hits++
+				p.mu.Unlock()
+				return pc, nil
+			}
+		}
+
+		// 正在建立的连接能够容纳更多的 session 时，等待其建立完成而不是建立新的连接
+		pending := p.dialing[key]*(p.opts.MaxSessionsPerClient-1) > p.waiting[key]
+		if !pending && (p.opts.MaxClientsPerKey <= 0 || len(p.clients[key])+p.dialing[key] < p.opts.MaxClientsPerKey) {
+			p.dialing[key]++
+			p.stats.Dials++
+			p.mu.Unlock()
+			return p.dial(ctx, key, addr, config)
+		}
+
+		// 等待新的连接建立、其他 session 关闭或连接被移除
+		release := p.release
+		if pending {
+			p.waiting[key]++
+		}
+		p.mu.Unlock()
+
+		var err error
+		select {
+		case <-release:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if pending {
+			p.mu.Lock()
+			p.waiting[key]--
+			if p.waiting[key] <= 0 {
+				delete(p.waiting, key)
+			}
+			p.mu.Unlock()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// dial 建立一个新的连接并加入连接池，新的连接上已经占用了一个 session 名额
+func (p *ClientPool) dial(ctx context.Context, key, addr string, config *Config) (*pooledClient, error) {
+	client, err := ConnectContext(ctx, addr, config)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dialing[key]--
+	if p.dialing[key] <= 0 {
+		delete(p.dialing, key)
+	}
+	if err != nil {
+		p.stats.DialErrors++
+		p.notify()
+		return nil, err
+	}
+	if p.closed {
+		client.Close()
+		return nil, errPoolClosed
+	}
+
+	pc := &pooledClient{
+		client:   client,
+		key:      key,
+		sessions: 1,
+		limit:    p.opts.MaxSessionsPerClient,
+		lastUsed: time.Now(),
+	}
+	p.clients[key] = append(p.clients[key], pc)
+	p.stats.ActiveSessions++
+	p.notify()
+	go p.watch(pc)
+	return pc, nil
+}
+
+// releaseSession 归还 pc 上的一个 session 名额
+func (p *ClientPool) releaseSession(pc *pooledClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pc.sessions--
+	pc.lastUsed = time.Now()
+	p.stats.ActiveSessions--
+	p.notify()
+}
+
+// watch 等待连接断开，并将其移出连接池
+func (p *ClientPool) watch(pc *pooledClient) {
+	pc.client.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.evict(pc)
+}
+
+// evict 将 pc 移出连接池并关闭，调用者需要持有锁
+func (p *ClientPool) evict(pc *pooledClient) {
+	if pc.dead {
+		return
+	}
+	pc.dead = true
+	clients := p.clients[pc.key]
+	for i, c := range clients {
+		if c == pc {
+			clients = append(clients[:i], clients[i+1:]...)
+			break
+		}
+	}
+	if len(clients) == 0 {
+		delete(p.clients, pc.key)
+	} else {
+		p.clients[pc.key] = clients
+	}
+	p.stats.Evictions++
+	go pc.client.Close()
+	p.notify()
+}
+
+// notify 唤醒等待名额的 OpenSession，调用者需要持有锁
+func (p *ClientPool) notify() {
+	close(p.release)
+	p.release = make(chan struct{})
+}
+
+// cleanup 定期关闭空闲时间超过 IdleTimeout 的连接
+func (p *ClientPool) cleanup() {
+	ticker := time.NewTicker(p.opts.CleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			var idle []*pooledClient
+			for _, clients := range p.clients {
+				for _, pc := range clients {
+					if pc.sessions == 0 && now.Sub(pc.lastUsed) >= p.opts.IdleTimeout {
+						idle = append(idle, pc)
+					}
+				}
+			}
+			for _, pc := range idle {
+				p.evict(pc)
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// Stats 返回连接池的统计信息
+func (p *ClientPool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	for _, clients := range p.clients {
+		stats.Clients += len(clients)
+	}
+	return stats
+}
+
+// Close 关闭连接池以及其中的所有连接，已经打开的 session 将随连接一起被关闭
+func (p *ClientPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	close(p.stop)
+
+	var all []*pooledClient
+	for _, clients := range p.clients {
+		all = append(all, clients...)
+	}
+	for _, pc := range all {
+		p.evict(pc)
+	}
+	return nil
+}
+
+// poolKey 以登陆用户、目标地址以及配置指纹构成连接池的键
+func poolKey(addr string, config *Config) string {
+	return fmt.Sprintf("%s@%s#%s", config.User, addr, configFingerprint(config))
+}
+
+// configFingerprint 计算影响连接建立的配置项的指纹：算法、超时、代理、跳板机等可以比较的配置项以其内容参与计算，
+// 由 gossh 构造的身份认证方法以其名称与身份（例如公钥指纹）参与计算。
+// 回调函数以及其它身份认证方法无法比较内容，只有同一个函数或闭包实例才被视为相同，见 instanceID。
+// Observer、Logger 与 Metrics 只影响事件、日志与指标的记录，不参与计算
+func configFingerprint(config *Config) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%d|%q|%q|%q|%q|%q\n", instanceID(config.Rand), config.RekeyThreshold,
+		config.KeyExchanges, config.Ciphers, config.MACs, config.HostKeyAlgorithms, config.ClientVersion)
+	fmt.Fprintf(h, "timeout:%s|%s\n", config.Timeout, config.HandshakeTimeout)
+	for _, auth := range config.Auth {
+		if m, ok := auth.(*authMethod); ok {
+			fmt.Fprintf(h, "auth:%s\n", m.id())
+		} else {
+			fmt.Fprintf(h, "auth:%s\n", instanceID(auth))
+		}
+	}
+	fmt.Fprintf(h, "%s|%s|%s\n", instanceID(config.HostKeyCallback), instanceID(config.BannerCallback), instanceID(config.Dialer))
+	fmt.Fprintf(h, "%s|%s\n", instanceID(config.GlobalRequestHandlers), instanceID(config.ChannelHandlers))
+	if config.Proxy != nil {
+		fmt.Fprintf(h, "proxy:%s|%s|%s\n", config.Proxy, config.Proxy.User, config.Proxy.Password)
+	}
+	fmt.Fprintf(h, "proxycommand:%q\n", config.ProxyCommand)
+	if keepAlive := config.KeepAlive; keepAlive != nil {
+		fmt.Fprintf(h, "keepalive:%s|%s|%d|%s\n", keepAlive.Interval, keepAlive.Timeout, keepAlive.MaxMissed, instanceID(keepAlive.OnDead))
+	}
+	fmt.Fprintf(h, "control:%q|sendenv:%q\n", config.ControlPath, config.SendEnv)
+	for _, jump := range config.JumpHosts {
+		if jump == nil {
+			continue
+		}
+		if jump.Config == nil {
+			fmt.Fprintf(h, "jump:%s\n", jump.Addr)
+		} else {
+			fmt.Fprintf(h, "jump:%s|%s@%s\n", jump.Addr, jump.Config.User, configFingerprint(jump.Config))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// instanceID 无法比较内容的值的身份，只有同一个函数、同一个闭包或者同一个实例得到相同的结果。
+// 函数值以其闭包的地址区分：reflect.Value.Pointer 返回的代码地址无法区分由同一个函数字面量生成、捕获了不同状态的闭包
+func instanceID(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return "nil"
+	case reflect.Func:
+		if rv.IsNil() {
+			return "nil"
+		}
+		fn := reflect.New(rv.Type())
+		fn.Elem().Set(rv)
+		return fmt.Sprintf("%T:%x", v, *(*uintptr)(unsafe.Pointer(fn.Pointer())))
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Slice, reflect.UnsafePointer:
+		return fmt.Sprintf("%T:%x", v, rv.Pointer())
+	}
+	return fmt.Sprintf("%T:%#v", v, v)
+}
@@ -0,0 +1,107 @@
+package gossh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestPoolKeyFingerprint(t *testing.T) {
+	// 捕获了不同状态的同一个函数字面量，例如以不同的 known_hosts 文件构造的回调
+	newCallback := func(file string) HostKeyCallback {
+		return func(hostname string, remote net.Addr, key PublicKey) error {
+			if file == "" {
+				return errors.New("no known_hosts file")
+			}
+			return nil
+		}
+	}
+	callback := newCallback("known_hosts")
+	base := func() *Config {
+		config := testConfig(callback)
+		config.Ciphers = []string{"aes128-ctr"}
+		return config
+	}
+	key := poolKey("example.com:22", base())
+
+	// 分别构造但内容相同的配置共用同一个键
+	if other := poolKey("example.com:22", base()); other != key {
+		t.Error("equal configs have different pool keys")
+	}
+
+	tests := map[string]func(config *Config){
+		"user":         func(config *Config) { config.User = "other" },
+		"password":     func(config *Config) { config.Auth = []AuthMethod{PasswordAuth("other")} },
+		"ciphers":      func(config *Config) { config.Ciphers = []string{"aes256-ctr"} },
+		"timeout":      func(config *Config) { config.Timeout = time.Second },
+		"host key":     func(config *Config) { config.HostKeyCallback = newCallback("other_known_hosts") },
+		"raw auth":     func(config *Config) { config.Auth = []AuthMethod{ssh.Password(testPassword)} },
+		"jump host":    func(config *Config) { config.JumpHosts = []*JumpHost{{Addr: "bastion:22"}} },
+		"proxycommand": func(config *Config) { config.ProxyCommand = "nc %h %p" },
+	}
+	for name, modify := range tests {
+		config := base()
+		modify(config)
+		if poolKey("example.com:22", config) == key {
+			t.Errorf("%s: different configs share a pool key", name)
+		}
+	}
+	if poolKey("example.org:22", base()) == key {
+		t.Error("different addresses share a pool key")
+	}
+
+	// ssh 包中的认证方法无法比较内容，只有同一个实例被视为相同
+	raw := ssh.Password(testPassword)
+	first, second := base(), base()
+	first.Auth, second.Auth = []AuthMethod{raw}, []AuthMethod{raw}
+	if poolKey("example.com:22", first) != poolKey("example.com:22", second) {
+		t.Error("configs sharing an auth method instance have different pool keys")
+	}
+}
+
+func TestPoolKeyIgnoresObservability(t *testing.T) {
+	config := testConfig(IgnoreHostKey)
+	key := poolKey("example.com:22", config)
+
+	// 指标的变化以及替换 Observer、Metrics 不影响指纹
+	config.Metrics = NewMetricsRegistry()
+	metricsObserver{registry: config.Metrics}.OnConnect(ConnectEvent{Addr: "example.com:22", User: "tester", Err: ErrAuthFailed})
+	config.Observer = NopObserver{}
+	if poolKey("example.com:22", config) != key {
+		t.Error("Observer or Metrics changed the pool key")
+	}
+}
+
+func TestClientPoolReuse(t *testing.T) {
+	server := startTestServer(t)
+	pool := NewClientPool(PoolOptions{})
+	defer pool.Close()
+
+	accepted := 0
+	config := testConfig(func(hostname string, remote net.Addr, key PublicKey) error {
+		accepted++
+		return nil
+	})
+	other := testConfig(IgnoreHostKey)
+	equal := testConfig(IgnoreHostKey)
+
+	for _, c := range []*Config{config, config, other, other, equal} {
+		sess, err := pool.OpenSession(context.Background(), server.addr, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sess.Close()
+	}
+
+	stats := pool.Stats()
+	if stats.Dials != 2 || stats.Hits != 3 {
+		t.Fatalf("dials = %d, hits = %d, want 2 and 3", stats.Dials, stats.Hits)
+	}
+	if accepted != 1 {
+		t.Fatalf("host key callback called %d times, want 1", accepted)
+	}
+}
@@ -0,0 +1,170 @@
+package gossh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 本文件中的函数用于通过本地辅助进程的标准输入、输出承载 SSH 连接，类似于 Open-SSH 的 ProxyCommand
+
+// ExpandProxyCommand 展开 command 中的 %h（目标主机）、%p（目标端口）、%r（登陆用户）以及 %%
+func ExpandProxyCommand(command, addr, user string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(command); i++ {
+		if command[i] != '%' {
+			b.WriteByte(command[i])
+			continue
+		}
+		if i+1 >= len(command) {
+			return "", fmt.Errorf("invalid proxy command '%s': trailing '%%'", command)
+		}
+		i++
+		switch command[i] {
+		case 'h':
+			b.WriteString(host)
+		case 'p':
+			b.WriteString(port)
+		case 'r':
+			b.WriteString(user)
+		case '%':
+			b.WriteByte('%')
+		default:
+			return "", fmt.Errorf("invalid proxy command '%s': unknown token '%%%c'", command, command[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// ProxyCommandDialer 返回一个 DialFunc，每次调用时在本地启动 command 进程，并以其标准输入、输出作为网络连接。
+// command 中的 token 将由 ExpandProxyCommand 展开，user 用于展开 %r；进程的标准错误输出将被写入 stderr，为 nil 时丢弃。
+// 关闭返回的连接时，将关闭进程的标准输入，并结束该进程。
+func ProxyCommandDialer(command, user string, stderr io.Writer) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		cmdline, err := ExpandProxyCommand(command, addr, user)
+		if err != nil {
+			return nil, err
+		}
+
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", cmdline)
+		} else {
+			// 使用 exec 替换 shell 进程，以便关闭连接时能够直接结束辅助进程
+			cmd = exec.Command("/bin/sh", "-c", "exec "+cmdline)
+		}
+		cmd.Stderr = stderr
+
+		// 使用 os.Pipe 而不是 StdinPipe、StdoutPipe，以支持读写的 deadline
+		stdinR, stdinW, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		stdoutR, stdoutW, err := os.Pipe()
+		if err != nil {
+			stdinR.Close()
+			stdinW.Close()
+			return nil, err
+		}
+		cmd.Stdin = stdinR
+		cmd.Stdout = stdoutW
+
+		if err := cmd.Start(); err != nil {
+			stdinR.Close()
+			stdinW.Close()
+			stdoutR.Close()
+			stdoutW.Close()
+			return nil, fmt.Errorf("start proxy command '%s': %w", cmdline, err)
+		}
+		// 子进程已经持有管道的另一端
+		stdinR.Close()
+		stdoutW.Close()
+
+		return &commandConn{
+			cmd:    cmd,
+			stdin:  stdinW,
+			stdout: stdoutR,
+			addr:   commandAddr(addr),
+		}, nil
+	}
+}
+
+// commandConn 以辅助进程的标准输入、输出实现的 net.Conn
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  *os.File
+	stdout *os.File
+	addr   commandAddr
+
+	closeOnce sync.Once
+}
+
+func (c *commandConn) Read(b []byte) (int, error) {
+	return c.stdout.Read(b)
+}
+
+func (c *commandConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+// Close 关闭辅助进程的标准输入、输出，结束并回收该进程
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.stdout.Close()
+		// 进程可能已经退出，忽略结束进程时的错误
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr {
+	return commandAddr("")
+}
+
+// RemoteAddr 返回目标地址，以便 known_hosts 等主机公钥验证方式使用
+func (c *commandConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func (c *commandConn) SetDeadline(t time.Time) error {
+	if err := c.stdout.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.stdin.SetWriteDeadline(t)
+}
+
+func (c *commandConn) SetReadDeadline(t time.Time) error {
+	return c.stdout.SetReadDeadline(t)
+}
+
+func (c *commandConn) SetWriteDeadline(t time.Time) error {
+	return c.stdin.SetWriteDeadline(t)
+}
+
+// commandAddr 经由辅助进程连接的目标地址
+type commandAddr string
+
+func (a commandAddr) Network() string {
+	return "proxycommand"
+}
+
+func (a commandAddr) String() string {
+	return string(a)
+}
@@ -0,0 +1,85 @@
+package gossh
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestExpandProxyCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+		wantErr bool
+	}{
+		{command: "nc %h %p", want: "nc example.com 2222"},
+		{command: "ssh -W %h:%p %r@bastion", want: "ssh -W example.com:2222 deploy@bastion"},
+		{command: "echo 100%%", want: "echo 100%"},
+		{command: "nc %h %", wantErr: true},
+		{command: "nc %x", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ExpandProxyCommand(tt.command, "example.com:2222", "deploy")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.command)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %q, %v, want %q", tt.command, got, err, tt.want)
+		}
+	}
+}
+
+// TestProxyCommandHelper 作为 ProxyCommand 的辅助进程运行：连接 "--" 之后给出的主机与端口，并转发标准输入、输出
+func TestProxyCommandHelper(t *testing.T) {
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) != 3 {
+		t.Skip("only run as a proxy command")
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(args[1], args[2]))
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+		os.Exit(1)
+	}
+	os.Stderr.WriteString("helper connected")
+	go func() {
+		io.Copy(conn, os.Stdin)
+		conn.Close()
+	}()
+	io.Copy(os.Stdout, conn)
+	os.Exit(0)
+}
+
+func TestConnectThroughProxyCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("proxy command test requires /bin/sh")
+	}
+	server := startTestServer(t)
+	var stderr bytes.Buffer
+	config := testConfig(IgnoreHostKey)
+	config.ProxyCommand = os.Args[0] + " -test.run=^TestProxyCommandHelper$ -- %h %p"
+	config.ProxyCommandStderr = &stderr
+	client, err := Connect(server.addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := client.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output, err := session.RunForOutput("via proxy command"); err != nil || string(output) != "via proxy command" {
+		t.Errorf("output = %q, err = %v", output, err)
+	}
+	client.Close()
+	if !bytes.Contains(stderr.Bytes(), []byte("helper connected")) {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+}
@@ -0,0 +1,440 @@
+package gossh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// 本文件实现了一个在连接中断后自动重连，并重新建立端口转发的客户端
+
+// ConnState ReconnectingClient 的连接状态
+type ConnState int
+
+const (
+	StateConnecting   ConnState = iota // 正在建立连接
+	StateConnected                     // 连接已经建立
+	StateDisconnected                  // 连接已经中断，等待重连
+	StateClosed                        // 客户端已经关闭，不再重连
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	case StateClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("ConnState(%d)", int(s))
+}
+
+// StateEvent 连接状态变化事件
+type StateEvent struct {
+	State   ConnState
+	Attempt int   // 本轮重连的尝试次数，从 1 开始
+	Err     error // 导致连接中断或者本次连接失败的原因
+	Time    time.Time
+}
+
+// StateChangeCallback 连接状态变化时被调用，该函数不应长时间阻塞
+type StateChangeCallback func(event StateEvent)
+
+// Backoff 指数退避策略，第 n 次重试前等待 min(Max, Initial * Multiplier^(n-1))，并在此基础上随机浮动 Jitter 比例
+type Backoff struct {
+	Initial    time.Duration // 首次重试前的等待时间，为 0 时使用 1s
+	Max        time.Duration // 最长等待时间，为 0 时使用 1min
+	Multiplier float64       // 每次重试等待时间的增长倍数，小于 1 时使用 2
+	Jitter     float64       // 随机浮动比例，取值 [0, 1]
+}
+
+// Delay 返回第 attempt 次重试前的等待时间，attempt 从 1 开始
+func (b Backoff) Delay(attempt int) time.Duration {
+	initial, max, multiplier := b.Initial, b.Max, b.Multiplier
+	if initial <= 0 {
+		initial = time.Second
+	}
+	if max <= 0 {
+		max = time.Minute
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if delay > float64(max) {
+		delay = float64(max)
+	}
+	if b.Jitter > 0 {
+		jitter := math.Min(b.Jitter, 1)
+		delay += delay * jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(delay)
+}
+
+// ReconnectOptions ReconnectingClient 的选项
+type ReconnectOptions struct {
+	Backoff            Backoff             // 重连退避策略
+	MaxAttempts        int                 // 每轮重连的最大尝试次数，小于等于 0 时不做限制
+	KeepAliveInterval  time.Duration       // 发送 keepalive 请求的间隔，为 0 时仅依靠连接断开检测
+	KeepAliveTimeout   time.Duration       // 等待 keepalive 回应的超时时间，为 0 时等于 KeepAliveInterval
+	KeepAliveMaxMissed int                 // 连续未收到回应次数达到该值时认为连接已经中断，小于等于 0 时为 3
+	OnStateChange      StateChangeCallback // 连接状态变化回调
+}
+
+// ReconnectingClient 对 SSHClient 的包装，连接中断（Conn.Wait 返回或 keepalive 无回应）后将以指数退避的方式自动重连，
+// 并重新建立通过 ForwardLocal、ForwardRemote 注册的端口转发
+type ReconnectingClient struct {
+	addr   string
+	config *Config
+	opts   ReconnectOptions
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	client    *SSHClient
+	state     ConnState
+	connected chan struct{} // 连接建立后被关闭，连接中断时被替换
+	closeOnce sync.Once
+	locals    []net.Listener
+	remotes   []*remoteForward
+}
+
+// remoteForward 通过 ForwardRemote 注册的远程端口转发
+type remoteForward struct {
+	netType, addr           string
+	localNetType, localAddr string
+}
+
+// NewReconnectingClient 与目标建立连接，并在连接中断时自动重连。
+// 首次连接失败时直接返回错误；ctx 仅用于控制首次连接。
+func NewReconnectingClient(ctx context.Context, addr string, config *Config, opts ReconnectOptions) (*ReconnectingClient, error) {
+	if config == nil {
+		return nil, errors.New("invalid config")
+	}
+	rc := &ReconnectingClient{
+		addr:      addr,
+		config:    config,
+		opts:      opts,
+		connected: make(chan struct{}),
+	}
+	rc.ctx, rc.cancel = context.WithCancel(context.Background())
+
+	rc.setState(StateEvent{State: StateConnecting, Attempt: 1})
+	client, err := ConnectContext(ctx, addr, config)
+	if err != nil {
+		rc.cancel()
+		rc.setState(StateEvent{State: StateClosed, Err: err})
+		return nil, err
+	}
+	rc.onConnected(client, 1)
+	go rc.monitor(client)
+	return rc, nil
+}
+
+// Client 返回当前的 SSHClient，连接中断期间返回 nil
+func (rc *ReconnectingClient) Client() *SSHClient {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.state != StateConnected {
+		return nil
+	}
+	return rc.client
+}
+
+// WaitConnected 阻塞直至连接可用并返回当前的 SSHClient，ctx 被取消或客户端关闭时返回错误
+func (rc *ReconnectingClient) WaitConnected(ctx context.Context) (*SSHClient, error) {
+	for {
+		rc.mu.Lock()
+		state, client, connected := rc.state, rc.client, rc.connected
+		rc.mu.Unlock()
+
+		switch state {
+		case StateConnected:
+			return client, nil
+		case StateClosed:
+			return nil, errClientClosed
+		}
+		select {
+		case <-connected:
+		case <-rc.ctx.Done():
+			return nil, errClientClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// State 当前的连接状态
+func (rc *ReconnectingClient) State() ConnState {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.state
+}
+
+// ForwardLocal 在本地监听 localNetType、localAddr，并将接受的连接经由当前的 SSH 连接转发至远程的 netType、addr，
+// 即 Open-SSH 的 ssh -L。本地监听器在重连期间保持打开，连接中断期间接受的连接将等待重连完成后再转发。
+func (rc *ReconnectingClient) ForwardLocal(localNetType, localAddr, netType, addr string) (net.Addr, error) {
+	listener, err := net.Listen(localNetType, localAddr)
+	if err != nil {
+		return nil, err
+	}
+	rc.mu.Lock()
+	if rc.state == StateClosed {
+		rc.mu.Unlock()
+		listener.Close()
+		return nil, errClientClosed
+	}
+	rc.locals = append(rc.locals, listener)
+	rc.mu.Unlock()
+
+	go func() {
+		for {
+			lconn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				client, err := rc.WaitConnected(rc.ctx)
+				if err != nil {
+					lconn.Close()
+					return
+				}
+				if err := client.NewDirector().BindConnTo(lconn, netType, addr, rc.ctx, rc.ctx); err != nil {
+					lconn.Close()
+				}
+			}()
+		}
+	}()
+	return listener.Addr(), nil
+}
+
+// ForwardRemote 请求服务端监听 netType、addr，并将服务端接受的连接转发至本地的 localNetType、localAddr，
+// 即 Open-SSH 的 ssh -R。每次重连成功后都将重新请求服务端监听。
+func (rc *ReconnectingClient) ForwardRemote(netType, addr, localNetType, localAddr string) error {
+	forward := &remoteForward{
+		netType:      netType,
+		addr:         addr,
+		localNetType: localNetType,
+		localAddr:    localAddr,
+	}
+
+	rc.mu.Lock()
+	if rc.state == StateClosed {
+		rc.mu.Unlock()
+		return errClientClosed
+	}
+	rc.remotes = append(rc.remotes, forward)
+	client, state := rc.client, rc.state
+	rc.mu.Unlock()
+
+	if state == StateConnected {
+		return rc.listenRemote(client, forward)
+	}
+	return nil
+}
+
+// listenRemote 在 client 上建立一个远程端口转发，直至 client 断开
+func (rc *ReconnectingClient) listenRemote(client *SSHClient, forward *remoteForward) error {
+	listener, err := client.Listen(forward.netType, forward.addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer listener.Close()
+		for {
+			rconn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				lconn, err := net.Dial(forward.localNetType, forward.localAddr)
+				if err != nil {
+					rconn.Close()
+					return
+				}
+				go func() {
+					io.Copy(lconn, rconn)
+					lconn.Close()
+					rconn.Close()
+				}()
+				io.Copy(rconn, lconn)
+				lconn.Close()
+				rconn.Close()
+			}()
+		}
+	}()
+	return nil
+}
+
+// Close 关闭当前连接以及所有本地监听器，并停止重连
+func (rc *ReconnectingClient) Close() error {
+	var err error
+	rc.closeOnce.Do(func() {
+		// 先取消 ctx 再读取 rc.client，与 onConnected 的检查配合
+		rc.cancel()
+
+		rc.mu.Lock()
+		client, locals := rc.client, rc.locals
+		rc.locals = nil
+		rc.mu.Unlock()
+
+		for _, l := range locals {
+			l.Close()
+		}
+		if client != nil {
+			err = client.Close()
+		}
+		rc.setState(StateEvent{State: StateClosed})
+	})
+	return err
+}
+
+// monitor 等待连接中断，并在中断后重连，直至客户端被关闭
+func (rc *ReconnectingClient) monitor(client *SSHClient) {
+	for {
+		// 连接断开时已经关闭，keepalive 无回应时则由 KeepAlive 以该原因关闭，
+		// 这里不再调用 Close，以免断开原因被记录为 ErrClosedByClient
+		err := rc.waitLost(client)
+		if rc.ctx.Err() != nil {
+			return
+		}
+		rc.mu.Lock()
+		if rc.client == client {
+			rc.client = nil
+		}
+		rc.mu.Unlock()
+		rc.setState(StateEvent{State: StateDisconnected, Err: err})
+
+		client = rc.reconnect()
+		if client == nil {
+			return
+		}
+	}
+}
+
+// waitLost 阻塞至 client 断开或 keepalive 连续无回应，返回中断原因
+func (rc *ReconnectingClient) waitLost(client *SSHClient) error {
+	lost := make(chan error, 2)
+	go func() {
+		lost <- client.Wait()
+	}()
+
+	if rc.opts.KeepAliveInterval > 0 {
+		cancel := client.KeepAlive(KeepAliveConfig{
+			Interval:  rc.opts.KeepAliveInterval,
+			Timeout:   rc.opts.KeepAliveTimeout,
+			MaxMissed: rc.opts.KeepAliveMaxMissed,
+			OnDead: func(err error) {
+				lost <- err
+			},
+		})
+		defer cancel()
+	}
+
+	select {
+	case err := <-lost:
+		if err == nil {
+			err = io.EOF
+		}
+		return err
+	case <-rc.ctx.Done():
+		return rc.ctx.Err()
+	}
+}
+
+// reconnect 以退避策略重连，返回新的连接；客户端被关闭或达到最大尝试次数时返回 nil
+func (rc *ReconnectingClient) reconnect() *SSHClient {
+	for attempt := 1; rc.opts.MaxAttempts <= 0 || attempt <= rc.opts.MaxAttempts; attempt++ {
+		timer := time.NewTimer(rc.opts.Backoff.Delay(attempt))
+		select {
+		case <-rc.ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		rc.setState(StateEvent{State: StateConnecting, Attempt: attempt})
+		client, err := ConnectContext(rc.ctx, rc.addr, rc.config)
+		if err != nil {
+			if rc.ctx.Err() != nil {
+				return nil
+			}
+			rc.setState(StateEvent{State: StateDisconnected, Attempt: attempt, Err: err})
+			continue
+		}
+		if !rc.onConnected(client, attempt) {
+			return nil
+		}
+		return client
+	}
+
+	rc.Close()
+	return nil
+}
+
+// onConnected 记录新建立的连接，重新建立远程端口转发，并唤醒等待连接的转发任务。
+// 客户端已经被关闭时关闭 client 并返回 false；该检查与记录在同一次加锁中完成，Close 因而总能看到并关闭新的连接
+func (rc *ReconnectingClient) onConnected(client *SSHClient, attempt int) bool {
+	rc.mu.Lock()
+	if rc.ctx.Err() != nil {
+		rc.mu.Unlock()
+		client.Close()
+		return false
+	}
+	rc.client = client
+	remotes := append([]*remoteForward(nil), rc.remotes...)
+	rc.mu.Unlock()
+
+	for _, forward := range remotes {
+		if err := rc.listenRemote(client, forward); err != nil {
+			rc.setState(StateEvent{State: StateConnecting, Attempt: attempt, Err: fmt.Errorf("re-establish remote forward %s: %w", forward.addr, err)})
+		}
+	}
+	rc.setState(StateEvent{State: StateConnected, Attempt: attempt})
+	return true
+}
+
+// setState 更新连接状态并触发回调
+func (rc *ReconnectingClient) setState(event StateEvent) {
+	event.Time = time.Now()
+	rc.mu.Lock()
+	if rc.state == StateClosed {
+		rc.mu.Unlock()
+		return
+	}
+	prev := rc.state
+	rc.state = event.State
+	switch {
+	case event.State == StateConnected:
+		close(rc.connected)
+	case prev == StateConnected:
+		rc.connected = make(chan struct{})
+	}
+	rc.mu.Unlock()
+
+	level := LevelInfo
+	if event.Err != nil {
+		level = LevelWarn
+	}
+	loggerOf(rc.config).Log(level, "connection state changed", "addr", rc.addr, "state", event.State, "attempt", event.Attempt, "error", event.Err)
+
+	if rc.opts.OnStateChange != nil {
+		rc.opts.OnStateChange(event)
+	}
+}
+
+var errClientClosed = errors.New("client closed")
@@ -0,0 +1,207 @@
+package gossh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		backoff Backoff
+		attempt int
+		want    time.Duration
+	}{
+		{backoff: Backoff{}, attempt: 1, want: time.Second},
+		{backoff: Backoff{}, attempt: 3, want: 4 * time.Second},
+		{backoff: Backoff{}, attempt: 20, want: time.Minute},
+		{backoff: Backoff{Initial: 100 * time.Millisecond, Multiplier: 3}, attempt: 3, want: 900 * time.Millisecond},
+		{backoff: Backoff{Initial: time.Second, Max: 5 * time.Second}, attempt: 4, want: 5 * time.Second},
+		{backoff: Backoff{Initial: time.Second}, attempt: 0, want: time.Second},
+	}
+	for _, tt := range tests {
+		if got := tt.backoff.Delay(tt.attempt); got != tt.want {
+			t.Errorf("%+v.Delay(%d) = %s, want %s", tt.backoff, tt.attempt, got, tt.want)
+		}
+	}
+
+	jittered := Backoff{Initial: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if d := jittered.Delay(1); d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Fatalf("jittered delay %s out of range", d)
+		}
+	}
+}
+
+// connRecorder 记录 Dialer 建立的网络连接，用于模拟连接中断
+type connRecorder struct {
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (r *connRecorder) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err == nil {
+		r.mu.Lock()
+		r.conns = append(r.conns, conn)
+		r.mu.Unlock()
+	}
+	return conn, err
+}
+
+func (r *connRecorder) last() net.Conn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.conns[len(r.conns)-1]
+}
+
+func TestReconnectingClient(t *testing.T) {
+	server := startTestServer(t)
+	recorder := &connRecorder{}
+	config := testConfig(IgnoreHostKey)
+	config.Dialer = recorder.dial
+
+	states := make(chan ConnState, 16)
+	rc, err := NewReconnectingClient(context.Background(), server.addr, config, ReconnectOptions{
+		Backoff: Backoff{Initial: 10 * time.Millisecond},
+		OnStateChange: func(event StateEvent) {
+			states <- event.State
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	first := rc.Client()
+	if first == nil || rc.State() != StateConnected {
+		t.Fatalf("state = %s after connecting", rc.State())
+	}
+
+	// 切断底层连接后应当自动重连
+	recorder.last().Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var client *SSHClient
+	for client == nil || client == first {
+		if client, err = rc.WaitConnected(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if client == first {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	session, err := client.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output, err := session.RunForOutput("reconnected"); err != nil || string(output) != "reconnected" {
+		t.Errorf("output = %q, err = %v", output, err)
+	}
+
+	rc.Close()
+	if rc.State() != StateClosed || rc.Client() != nil {
+		t.Errorf("state = %s after Close", rc.State())
+	}
+	if _, err := rc.WaitConnected(context.Background()); err == nil {
+		t.Error("WaitConnected succeeded after Close")
+	}
+
+	var seen []ConnState
+	for len(states) > 0 {
+		seen = append(seen, <-states)
+	}
+	want := []ConnState{StateConnecting, StateConnected, StateDisconnected, StateConnecting, StateConnected, StateClosed}
+	if len(seen) != len(want) {
+		t.Fatalf("states = %v, want %v", seen, want)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("states = %v, want %v", seen, want)
+		}
+	}
+}
+
+func TestReconnectingClientKeepsDisconnectReason(t *testing.T) {
+	server := startTestServer(t)
+	recorder := &connRecorder{}
+	config := testConfig(IgnoreHostKey)
+	config.Dialer = recorder.dial
+
+	disconnected := make(chan struct{}, 1)
+	rc, err := NewReconnectingClient(context.Background(), server.addr, config, ReconnectOptions{
+		Backoff: Backoff{Initial: time.Hour},
+		OnStateChange: func(event StateEvent) {
+			if event.State == StateDisconnected {
+				disconnected <- struct{}{}
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	first := rc.Client()
+
+	// 连接中断的原因不应被重连或者之后的 Close 覆盖为 ErrClosedByClient
+	recorder.last().Close()
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection loss not detected")
+	}
+	if reason := first.disconnectReason(nil); errors.Is(reason, ErrClosedByClient) {
+		t.Errorf("disconnect reason = %v after the connection was lost", reason)
+	}
+	rc.Close()
+	if reason := first.disconnectReason(nil); errors.Is(reason, ErrClosedByClient) {
+		t.Errorf("disconnect reason = %v after Close", reason)
+	}
+}
+
+func TestReconnectingClientCloseDuringReconnect(t *testing.T) {
+	server := startTestServer(t)
+	for i := 0; i < 20; i++ {
+		recorder := &connRecorder{}
+		config := testConfig(IgnoreHostKey)
+		config.Dialer = recorder.dial
+		rc, err := NewReconnectingClient(context.Background(), server.addr, config, ReconnectOptions{Backoff: Backoff{Initial: time.Millisecond}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder.last().Close()
+		time.Sleep(time.Duration(i) * time.Millisecond)
+		rc.Close()
+
+		// Close 与重连同时发生时，重连建立的连接同样需要被关闭
+		deadline := time.Now().Add(5 * time.Second)
+		for !recorder.allClosed() {
+			if time.Now().After(deadline) {
+				t.Fatal("connection left open after Close")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// allClosed 判断记录的连接是否都已经在本端被关闭
+func (r *connRecorder) allClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, conn := range r.conns {
+		if !connClosed(conn) {
+			return false
+		}
+	}
+	return true
+}
+
+// connClosed 判断 conn 是否已经在本端被关闭
+func connClosed(conn net.Conn) bool {
+	conn.SetReadDeadline(time.Now())
+	_, err := conn.Read(make([]byte, 1))
+	return errors.Is(err, net.ErrClosed)
+}
@@ -0,0 +1,276 @@
+package gossh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 本文件实现了对连接上打开的 session、通道、监听器以及端口转发的记录，以及连接的优雅关闭
+
+// ErrShuttingDown 连接正在关闭或已经关闭时，打开新的 session、通道或者监听器返回的错误
+var ErrShuttingDown = errors.New("ssh client is shutting down")
+
+// ResourceKind 连接上打开的资源的种类
+type ResourceKind string
+
+const (
+	ResourceSession  ResourceKind = "session"  // OpenSession 打开的 session
+	ResourceChannel  ResourceKind = "channel"  // OpenChannel 打开的通道
+	ResourceConn     ResourceKind = "conn"     // Dial 打开的连接，以及远程端口转发接受的连接
+	ResourceListener ResourceKind = "listener" // Listen 监听的远程端口
+	ResourceForward  ResourceKind = "forward"  // Director 的本地端口转发
+)
+
+// Resource 描述连接上一个仍处于打开状态的资源
+type Resource struct {
+	ID       uint64
+	Kind     ResourceKind
+	Type     string // 通道类型，例如 session、direct-tcpip、forwarded-tcpip；监听器与端口转发为网络类型
+	Addr     string // 通道或者端口转发的目标地址
+	Listen   string // 监听器以及端口转发所监听的地址
+	OpenedAt time.Time
+}
+
+// accepting 监听器与端口转发会接受新的连接，关闭时首先被关闭
+func (r Resource) accepting() bool {
+	return r.Kind == ResourceListener || r.Kind == ResourceForward
+}
+
+type registryEntry struct {
+	Resource
+	close func() error
+}
+
+// registry 记录连接上打开的资源，零值可以直接使用
+type registry struct {
+	mu       sync.Mutex
+	nextID   uint64
+	entries  map[uint64]*registryEntry
+	draining bool          // Shutdown 已被调用，不再打开新的资源
+	changed  chan struct{} // 有资源被移除时关闭并替换
+}
+
+// add 记录一个资源，连接正在关闭时返回 ErrShuttingDown
+func (r *registry) add(res Resource, close func() error) (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.draining {
+		return 0, ErrShuttingDown
+	}
+	if r.entries == nil {
+		r.entries = make(map[uint64]*registryEntry)
+	}
+	r.nextID++
+	res.ID = r.nextID
+	res.OpenedAt = time.Now()
+	r.entries[res.ID] = &registryEntry{Resource: res, close: close}
+	return res.ID, nil
+}
+
+// remove 移除一个资源，重复移除是安全的
+func (r *registry) remove(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.entries[id]; !ok {
+		return
+	}
+	delete(r.entries, id)
+	if r.changed != nil {
+		close(r.changed)
+		r.changed = nil
+	}
+}
+
+// release 连接断开后清除所有记录，之后不再打开新的资源
+func (r *registry) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.draining = true
+	r.entries = nil
+	if r.changed != nil {
+		close(r.changed)
+		r.changed = nil
+	}
+}
+
+// closing 连接是否正在关闭
+func (r *registry) closing() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.draining
+}
+
+// drain 停止打开新的资源，返回仍在打开状态的资源
+func (r *registry) drain() []*registryEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.draining = true
+	entries := make([]*registryEntry, 0, len(r.entries))
+	for _, entry := range r.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
+
+// wait 返回仍在打开状态的资源数量，以及在资源被移除时关闭的 chan
+func (r *registry) wait() (int, <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.changed == nil {
+		r.changed = make(chan struct{})
+	}
+	return len(r.entries), r.changed
+}
+
+// Resources 返回连接上仍处于打开状态的 session、通道、连接、监听器以及端口转发，按照打开的顺序排列。
+// session 在被关闭或者其命令执行结束后即不再被记录
+func (client *SSHClient) Resources() []Resource {
+	client.registry.mu.Lock()
+	defer client.registry.mu.Unlock()
+	resources := make([]Resource, 0, len(client.registry.entries))
+	for _, entry := range client.registry.entries {
+		resources = append(resources, entry.Resource)
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].ID < resources[j].ID })
+	return resources
+}
+
+// Shutdown 优雅地关闭连接：首先拒绝打开新的 session、通道以及监听器，关闭远程端口转发的监听器以及 Director 的端口转发，
+// 之后等待所有 session、通道以及连接（包括端口转发中正在复制数据的连接）关闭，最后关闭连接。
+// ctx 被取消或超时时将强制关闭剩余的资源以及连接，并返回 ctx.Err()
+func (client *SSHClient) Shutdown(ctx context.Context) error {
+	entries := client.registry.drain()
+	client.logger().Log(LevelInfo, "shutting down", "addr", client.addr, "resources", len(entries))
+	for _, entry := range entries {
+		if entry.accepting() {
+			entry.close()
+			client.registry.remove(entry.ID)
+		}
+	}
+
+	for {
+		n, changed := client.registry.wait()
+		if n == 0 {
+			return client.Close()
+		}
+		select {
+		case <-changed:
+		case <-client.closed:
+			// 连接已经断开，剩余的资源都已失效
+			return nil
+		case <-ctx.Done():
+			for _, entry := range client.registry.drain() {
+				entry.close()
+			}
+			client.Close()
+			return ctx.Err()
+		}
+	}
+}
+
+// track 记录一个资源，连接正在关闭时关闭 closer 并返回 ErrShuttingDown；返回的函数用于移除记录
+func (client *SSHClient) track(res Resource, closer func() error) (func(), error) {
+	id, err := client.registry.add(res, closer)
+	if err != nil {
+		closer()
+		return nil, err
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			client.registry.remove(id)
+		})
+	}, nil
+}
+
+// trackedConn 关闭时移除记录的连接
+type trackedConn struct {
+	net.Conn
+	untrack func()
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.untrack()
+	return err
+}
+
+// trackConn 记录 Dial 打开或者监听器接受的连接
+func (client *SSHClient) trackConn(conn net.Conn, err error, channelType, addr string) (net.Conn, error) {
+	if err != nil {
+		return nil, err
+	}
+	untrack, err := client.track(Resource{Kind: ResourceConn, Type: channelType, Addr: addr}, conn.Close)
+	if err != nil {
+		return nil, err
+	}
+	return &trackedConn{Conn: conn, untrack: untrack}, nil
+}
+
+// trackedChannel 关闭时移除记录的通道
+type trackedChannel struct {
+	Channel
+	untrack func()
+}
+
+func (c *trackedChannel) Close() error {
+	err := c.Channel.Close()
+	c.untrack()
+	return err
+}
+
+// trackedListener 远程端口转发的监听器，接受的连接同样被记录
+type trackedListener struct {
+	net.Listener
+	client  *SSHClient
+	untrack func()
+}
+
+func (l *trackedListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		conn, err = l.client.trackConn(conn, nil, "forwarded-tcpip", conn.RemoteAddr().String())
+		if err == nil {
+			return conn, nil
+		}
+		// 连接正在关闭，拒绝新的连接并等待监听器被关闭
+	}
+}
+
+func (l *trackedListener) Close() error {
+	err := l.Listener.Close()
+	l.untrack()
+	return err
+}
+
+// trackListener 记录远程端口转发的监听器
+func (client *SSHClient) trackListener(listener net.Listener, err error, network string) (net.Listener, error) {
+	if err != nil {
+		return nil, err
+	}
+	res := Resource{Kind: ResourceListener, Type: network, Listen: listener.Addr().String()}
+	untrack, err := client.track(res, listener.Close)
+	if err != nil {
+		return nil, err
+	}
+	return &trackedListener{Listener: listener, client: client, untrack: untrack}, nil
+}
+
+// rejectIfClosing 连接正在关闭时拒绝服务端打开的通道
+func (client *SSHClient) rejectIfClosing(newChannel ssh.NewChannel) bool {
+	if !client.registry.closing() {
+		return false
+	}
+	newChannel.Reject(ssh.Prohibited, "client is shutting down")
+	return true
+}
@@ -0,0 +1,130 @@
+package gossh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResources(t *testing.T) {
+	server := startTestServer(t)
+	echo := startEchoListener(t)
+	client, err := Connect(server.addr, testConfig(IgnoreHostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	session, err := client.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Dial("tcp", echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources := client.Resources()
+	if len(resources) != 2 {
+		t.Fatalf("resources = %+v", resources)
+	}
+	if r := resources[0]; r.Kind != ResourceSession || r.Type != "session" {
+		t.Errorf("resources[0] = %+v", r)
+	}
+	if r := resources[1]; r.Kind != ResourceConn || r.Type != "direct-tcpip" || r.Addr != echo || r.OpenedAt.IsZero() {
+		t.Errorf("resources[1] = %+v", r)
+	}
+	if resources[0].ID >= resources[1].ID {
+		t.Error("resources not ordered by opening")
+	}
+
+	// 关闭后不再被记录，重复关闭是安全的
+	conn.Close()
+	conn.Close()
+	session.Close()
+	if resources := client.Resources(); len(resources) != 0 {
+		t.Errorf("resources after close = %+v", resources)
+	}
+}
+
+func TestShutdownWaitsForResources(t *testing.T) {
+	server := startTestServer(t)
+	echo := startEchoListener(t)
+	client, err := Connect(server.addr, testConfig(IgnoreHostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Dial("tcp", echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- client.Shutdown(context.Background()) }()
+	for deadline := time.Now().Add(time.Second); !client.registry.closing(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Shutdown did not start draining")
+		}
+	}
+
+	// 关闭过程中拒绝打开新的资源，已经打开的连接仍然可用
+	if _, err := client.OpenSession(); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("OpenSession err = %v, want ErrShuttingDown", err)
+	}
+	if _, err := client.Dial("tcp", echo); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Dial err = %v, want ErrShuttingDown", err)
+	}
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := conn.Read(buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("read %q, err = %v", buf, err)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v with an open conn", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	conn.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return after the conn was closed")
+	}
+	select {
+	case <-client.closed:
+	case <-time.After(time.Second):
+		t.Fatal("connection not closed after Shutdown")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	server := startTestServer(t)
+	client, err := Connect(server.addr, testConfig(IgnoreHostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := client.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// 超时后强制关闭剩余的资源以及连接
+	start := time.Now()
+	if err := client.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Shutdown returned after %s", elapsed)
+	}
+	if _, err := session.RunForOutput("after shutdown"); err == nil {
+		t.Error("session still usable after a forced shutdown")
+	}
+}
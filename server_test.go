@@ -0,0 +1,189 @@
+package gossh
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 测试使用的 SSH 服务端：仅接受 testPassword 密码认证，exec 请求回显命令本身，direct-tcpip 通道连接至请求的目标
+
+const testPassword = "secret"
+
+type testServer struct {
+	addr    string
+	hostKey ssh.Signer // 服务端的主机私钥
+}
+
+// newTestSigner 生成一个 ed25519 私钥
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// newTestPrivateKey 生成一个 ECDSA 私钥，返回其 PEM 格式的内容以及对应的 Signer
+func newTestPrivateKey(t *testing.T) ([]byte, ssh.Signer) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), signer
+}
+
+// startTestServer 启动测试服务端，extraHostKeys 为额外的主机私钥（例如主机证书），测试结束时关闭
+func startTestServer(t *testing.T, extraHostKeys ...ssh.Signer) *testServer {
+	t.Helper()
+	server := &testServer{hostKey: newTestSigner(t)}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) == testPassword {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected for %s", conn.User())
+		},
+		// 声明支持公钥认证以便客户端尝试私钥，但拒绝所有公钥
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, fmt.Errorf("public key rejected for %s", conn.User())
+		},
+	}
+	config.AddHostKey(server.hostKey)
+	for _, key := range extraHostKeys {
+		config.AddHostKey(key)
+	}
+	server.addr = listenTestTCP(t, func(conn net.Conn) {
+		serveTestConn(conn, config)
+	})
+	return server
+}
+
+// listenTestTCP 在本地回环地址上监听，并在新的 goroutine 中以 handle 处理每个连接，测试结束时停止监听
+func listenTestTCP(t *testing.T, handle func(conn net.Conn)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// serveTestConn 以 config 完成握手，并处理 session 以及 direct-tcpip 通道
+func serveTestConn(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() == "direct-tcpip" {
+			go serveTestDirectTCPIP(newChannel)
+			continue
+		}
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Command string }
+				ssh.Unmarshal(req.Payload, &payload)
+				req.Reply(true, nil)
+				channel.Write([]byte(payload.Command))
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				return
+			}
+		}()
+	}
+}
+
+// serveTestDirectTCPIP 连接 direct-tcpip 通道请求的目标并双向转发数据，用于测试跳板机
+func serveTestDirectTCPIP(newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	go func() {
+		io.Copy(channel, conn)
+		channel.Close()
+	}()
+	io.Copy(conn, channel)
+	conn.Close()
+}
+
+// testConfig 使用测试服务端密码认证的配置
+func testConfig(callback HostKeyCallback) *Config {
+	config := DefaultConfigAuthByPasswd("tester", testPassword)
+	config.HostKeyCallback = callback
+	return config
+}
+
+// startEchoListener 启动一个回显数据的 TCP 服务，作为 direct-tcpip 的目标
+func startEchoListener(t *testing.T) string {
+	return listenTestTCP(t, func(conn net.Conn) {
+		defer conn.Close()
+		io.Copy(conn, conn)
+	})
+}
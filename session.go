@@ -20,10 +20,25 @@ import (
 type Session struct {
 	sess *ssh.Session
 	sync.Mutex
+
+	onClose func() // session 被关闭后调用，用于连接池归还名额
+	untrack func() // session 被关闭或者命令执行结束后调用，移除连接上的记录
 }
 
 func (s *Session) Close() error {
-	return s.sess.Close()
+	err := s.sess.Close()
+	s.finish()
+	if s.onClose != nil {
+		s.onClose()
+	}
+	return err
+}
+
+// finish 标记 session 已经结束，SSHClient.Shutdown 不再等待该 session
+func (s *Session) finish() {
+	if s.untrack != nil {
+		s.untrack()
+	}
 }
 
 // PreparePty 发送一个 pty-req 请求，附带的窗口大小信息从当前的标准输出文件中获取。
@@ -54,11 +69,13 @@ func (s *Session) Shell() error {
 	if err := s.sess.Shell(); err != nil {
 		return err
 	}
+	defer s.finish()
 	return s.sess.Wait()
 }
 
 // Exec Shell 发送一个 exec 请求，并阻塞至 exit-status 消息被接收
 func (s *Session) Exec(cmdline string) error {
+	defer s.finish()
 	return s.sess.Run(cmdline)
 }
 
@@ -311,11 +328,13 @@ func (s *Session) SetEnv(name, value string) error {
 
 // RunForCombineOutput 执行命令并等待至结束，返回远程执行结果的全部的输出。
 func (s *Session) RunForCombineOutput(command string) ([]byte, error) {
+	defer s.finish()
 	return s.sess.CombinedOutput(command)
 }
 
 // RunForOutput 执行命令并等待至结束，返回远程执行结果的全部的标准输出。
 func (s *Session) RunForOutput(command string) ([]byte, error) {
+	defer s.finish()
 	return s.sess.Output(command)
 }
 
@@ -0,0 +1,806 @@
+package gossh
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 本文件实现了 Open-SSH 客户端配置文件（~/.ssh/config）的解析，并将主机别名解析为 Config 以及目标地址
+
+const (
+	OpenSSHConfigPath = ".ssh/config"
+
+	maxIncludeDepth = 16 // Include 的最大嵌套深度
+	maxJumpDepth    = 8  // ProxyJump 递归解析的最大深度
+)
+
+// SSHConfig 解析后的 Open-SSH 客户端配置文件
+type SSHConfig struct {
+	Passphrase PassphraseProvider // 加密私钥的口令来源，在认证时才被调用；为 nil 时跳过加密的私钥
+
+	path       string
+	directives []*sshDirective
+}
+
+// sshDirective 配置文件中的一行，keyword 已被转换为小写
+type sshDirective struct {
+	keyword  string
+	args     []string
+	file     string
+	line     int
+	included []*sshDirective // Include 引入的文件内容
+}
+
+// multiValueKeywords 可以出现多次且每次都生效的选项，其余选项以第一次出现的值为准
+var multiValueKeywords = map[string]bool{
+	"identityfile":    true,
+	"certificatefile": true,
+	"sendenv":         true,
+}
+
+// LoadSSHConfig 读取并解析 Open-SSH 客户端配置文件，Include 指令中的相对路径以 path 所在的目录为基准
+func LoadSSHConfig(path string) (*SSHConfig, error) {
+	directives, err := parseSSHConfigFile(path, filepath.Dir(path), 0)
+	if err != nil {
+		return nil, err
+	}
+	return &SSHConfig{path: path, directives: directives}, nil
+}
+
+// ParseSSHConfig 从 r 中解析 Open-SSH 客户端配置，Include 指令中的相对路径以 dir 为基准
+func ParseSSHConfig(r io.Reader, dir string) (*SSHConfig, error) {
+	directives, err := parseSSHConfig(r, "<input>", dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &SSHConfig{path: "<input>", directives: directives}, nil
+}
+
+// ResolveSSHConfig 使用当前用户的 ~/.ssh/config 将 alias 解析为 Config 以及目标地址
+func ResolveSSHConfig(alias string) (*Config, string, error) {
+	path, err := SSHConfigPath(CurrentUser())
+	if err != nil {
+		return nil, "", err
+	}
+	conf, err := LoadSSHConfig(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return conf.Resolve(alias)
+}
+
+func parseSSHConfigFile(path, dir string, depth int) ([]*sshDirective, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseSSHConfig(file, path, dir, depth)
+}
+
+func parseSSHConfig(r io.Reader, name, dir string, depth int) ([]*sshDirective, error) {
+	var directives []*sshDirective
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		keyword, args, err := splitSSHConfigLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, lineNum, err)
+		}
+		d := &sshDirective{keyword: keyword, args: args, file: name, line: lineNum}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s:%d: missing argument for '%s'", name, lineNum, keyword)
+		}
+
+		if keyword == "include" {
+			if depth >= maxIncludeDepth {
+				return nil, fmt.Errorf("%s:%d: include nested too deeply", name, lineNum)
+			}
+			for _, pattern := range args {
+				pattern = expandHome(pattern)
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(dir, pattern)
+				}
+				matches, err := filepath.Glob(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: %v", name, lineNum, err)
+				}
+				for _, match := range matches {
+					included, err := parseSSHConfigFile(match, dir, depth+1)
+					if err != nil {
+						return nil, err
+					}
+					d.included = append(d.included, included...)
+				}
+			}
+		}
+		directives = append(directives, d)
+	}
+	return directives, scanner.Err()
+}
+
+// splitSSHConfigLine 将一行拆分为小写的关键字与参数，支持双引号包裹的参数。
+// 与 Open-SSH 相同，关键字与参数之间可以有一个 '='，其两侧可以有空白，例如 "keyword=value"、"keyword = value"
+func splitSSHConfigLine(line string) (string, []string, error) {
+	var fields []string
+	var b strings.Builder
+	inQuote, hasField, hasEqual := false, false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		// 关键字之后的第一个 '=' 是分隔符
+		separator := c == '=' && !hasEqual && (len(fields) == 0 && hasField || len(fields) == 1 && !hasField)
+		if separator {
+			hasEqual = true
+		}
+		switch {
+		case c == '"':
+			inQuote = !inQuote
+			hasField = true
+		case !inQuote && (c == ' ' || c == '\t' || separator):
+			if hasField {
+				fields = append(fields, b.String())
+				b.Reset()
+				hasField = false
+			}
+		case !inQuote && c == '#' && !hasField:
+			// 行尾注释
+			i = len(line)
+		default:
+			b.WriteByte(c)
+			hasField = true
+		}
+	}
+	if inQuote {
+		return "", nil, errors.New("unterminated quote")
+	}
+	if hasField {
+		fields = append(fields, b.String())
+	}
+	if len(fields) == 0 {
+		return "", nil, errors.New("empty line")
+	}
+	return strings.ToLower(fields[0]), fields[1:], nil
+}
+
+// sshConfigResolver 对一个主机别名求值配置
+type sshConfigResolver struct {
+	alias      string
+	values     map[string][]string
+	passphrase PassphraseProvider
+	final      bool // 是否为最终求值，见 Match final
+	wantFinal  bool // 是否出现了 Match final 或者 Match canonical
+}
+
+// first 返回 keyword 第一次出现时的第一个参数
+func (r *sshConfigResolver) first(keyword string) string {
+	if v := r.values[keyword]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// set 记录一个选项，除了 multiValueKeywords 中的选项外，以第一次出现的值为准。
+// 与 Open-SSH 相同，SendEnv 中以 '-' 开头的模式将移除之前记录的、与之匹配的模式；
+// 最终求值时已经记录的值不会被重复添加
+func (r *sshConfigResolver) set(d *sshDirective) {
+	if multiValueKeywords[d.keyword] {
+		for _, arg := range d.args {
+			values := r.values[d.keyword]
+			switch {
+			case d.keyword == "sendenv" && strings.HasPrefix(arg, "-"):
+				var kept []string
+				for _, v := range values {
+					if !wildcardMatch(arg[1:], v) {
+						kept = append(kept, v)
+					}
+				}
+				r.values[d.keyword] = kept
+			case r.final && containsString(values, arg):
+			default:
+				r.values[d.keyword] = append(values, arg)
+			}
+		}
+		return
+	}
+	if _, ok := r.values[d.keyword]; !ok {
+		r.values[d.keyword] = d.args
+	}
+}
+
+// apply 按顺序对配置求值，active 表示当前是否处于匹配的 Host 或 Match 块中
+func (r *sshConfigResolver) apply(directives []*sshDirective, active bool) error {
+	for _, d := range directives {
+		switch d.keyword {
+		case "host":
+			active = matchHostPatterns(d.args, r.alias)
+		case "match":
+			matched, err := r.match(d.args)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %v", d.file, d.line, err)
+			}
+			active = matched
+		case "include":
+			if active {
+				if err := r.apply(d.included, true); err != nil {
+					return err
+				}
+			}
+		default:
+			if active {
+				r.set(d)
+			}
+		}
+	}
+	return nil
+}
+
+// match 对 Match 块的条件求值，所有条件都满足时返回 true
+func (r *sshConfigResolver) match(criteria []string) (bool, error) {
+	// 无论其余条件是否满足，出现 final 或者 canonical 时都需要最终求值
+	for i := 0; i < len(criteria); i++ {
+		switch strings.TrimPrefix(strings.ToLower(criteria[i]), "!") {
+		case "canonical", "final":
+			r.wantFinal = true
+		case "host", "originalhost", "user", "localuser", "exec":
+			i++
+		}
+	}
+
+	for i := 0; i < len(criteria); i++ {
+		criterion := strings.ToLower(criteria[i])
+		negate := strings.HasPrefix(criterion, "!")
+		criterion = strings.TrimPrefix(criterion, "!")
+
+		var matched bool
+		switch criterion {
+		case "all":
+			matched = true
+		case "canonical", "final":
+			// 不支持主机名规范化，与 Open-SSH 相同，出现这两个条件时将对配置进行第二次（最终）求值，
+			// 两个条件都只在最终求值时满足
+			matched = r.final
+		case "host", "originalhost", "user", "localuser", "exec":
+			if i+1 >= len(criteria) {
+				return false, fmt.Errorf("missing argument for match criterion '%s'", criterion)
+			}
+			i++
+			arg := criteria[i]
+			switch criterion {
+			case "host":
+				matched = matchHostPatterns(strings.Split(arg, ","), r.hostname())
+			case "originalhost":
+				matched = matchHostPatterns(strings.Split(arg, ","), r.alias)
+			case "user":
+				matched = matchHostPatterns(strings.Split(arg, ","), r.remoteUser())
+			case "localuser":
+				matched = matchHostPatterns(strings.Split(arg, ","), CurrentUser())
+			case "exec":
+				command, err := r.expand(arg)
+				if err != nil {
+					return false, err
+				}
+				matched = runMatchExec(command)
+			}
+		default:
+			return false, fmt.Errorf("unsupported match criterion '%s'", criterion)
+		}
+
+		if matched == negate {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// runMatchExec 执行 Match exec 的命令，退出状态为 0 时返回 true
+func runMatchExec(command string) bool {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", command)
+	}
+	return cmd.Run() == nil
+}
+
+// hostname 目标主机名，未设置 HostName 时为别名
+func (r *sshConfigResolver) hostname() string {
+	hostname := r.first("hostname")
+	if hostname == "" {
+		return r.alias
+	}
+	// HostName 中仅支持 %h 以及 %%
+	hostname = strings.ReplaceAll(hostname, "%%", "\x00")
+	hostname = strings.ReplaceAll(hostname, "%h", r.alias)
+	return strings.ReplaceAll(hostname, "\x00", "%")
+}
+
+// port 目标端口，未设置时为 22
+func (r *sshConfigResolver) port() string {
+	if port := r.first("port"); port != "" {
+		return port
+	}
+	return "22"
+}
+
+// remoteUser 登陆用户，未设置时为当前用户
+func (r *sshConfigResolver) remoteUser() string {
+	if u := r.first("user"); u != "" {
+		return u
+	}
+	return CurrentUser()
+}
+
+// expand 展开 Open-SSH 配置中的 token：%% %C %d %h %i %L %l %n %p %r %u
+func (r *sshConfigResolver) expand(s string) (string, error) {
+	s = expandHome(s)
+	if !strings.Contains(s, "%") {
+		return s, nil
+	}
+
+	localHost, _ := os.Hostname()
+	shortHost := localHost
+	if i := strings.IndexByte(shortHost, '.'); i >= 0 {
+		shortHost = shortHost[:i]
+	}
+	home, _ := os.UserHomeDir()
+	hostname, port, remoteUser := r.hostname(), r.port(), r.remoteUser()
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 >= len(s) {
+			return "", fmt.Errorf("invalid token in '%s'", s)
+		}
+		i++
+		switch s[i] {
+		case '%':
+			b.WriteByte('%')
+		case 'C':
+			sum := sha1.Sum([]byte(localHost + hostname + port + remoteUser))
+			b.WriteString(hex.EncodeToString(sum[:]))
+		case 'd':
+			b.WriteString(home)
+		case 'h':
+			b.WriteString(hostname)
+		case 'i':
+			b.WriteString(strconv.Itoa(os.Getuid()))
+		case 'L':
+			b.WriteString(shortHost)
+		case 'l':
+			b.WriteString(localHost)
+		case 'n':
+			b.WriteString(r.alias)
+		case 'p':
+			b.WriteString(port)
+		case 'r':
+			b.WriteString(remoteUser)
+		case 'u':
+			b.WriteString(CurrentUser())
+		default:
+			return "", fmt.Errorf("unknown token '%%%c' in '%s'", s[i], s)
+		}
+	}
+	return b.String(), nil
+}
+
+// Lookup 返回 alias 对应的所有选项，键为小写的关键字，值为各次出现的参数
+func (c *SSHConfig) Lookup(alias string) (map[string][]string, error) {
+	r, err := c.evaluate(alias)
+	if err != nil {
+		return nil, err
+	}
+	return r.values, nil
+}
+
+func (c *SSHConfig) evaluate(alias string) (*sshConfigResolver, error) {
+	r := &sshConfigResolver{alias: alias, values: make(map[string][]string)}
+	if err := r.apply(c.directives, true); err != nil {
+		return nil, err
+	}
+	// 最终求值时第一次求值得到的选项仍然有效，例如 Match host 使用第一次求值得到的 HostName
+	if r.wantFinal {
+		r.final = true
+		if err := r.apply(c.directives, true); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Resolve 将主机别名 alias 解析为 Config 以及目标地址（host:port）。
+// 支持的选项：HostName、Port、User、IdentityFile、IdentitiesOnly、ProxyJump、ProxyCommand、UserKnownHostsFile、
+// StrictHostKeyChecking、UpdateHostKeys、Ciphers、KexAlgorithms、MACs、HostKeyAlgorithms、SendEnv、ConnectTimeout、
+// ServerAliveInterval、ServerAliveCountMax 以及 ControlPath；其余选项将被忽略。
+func (c *SSHConfig) Resolve(alias string) (*Config, string, error) {
+	return c.resolve(alias, 0)
+}
+
+func (c *SSHConfig) resolve(alias string, depth int) (*Config, string, error) {
+	r, err := c.evaluate(alias)
+	if err != nil {
+		return nil, "", err
+	}
+	r.passphrase = c.Passphrase
+
+	addr := net.JoinHostPort(r.hostname(), r.port())
+	config := &Config{User: r.remoteUser()}
+
+	if err := r.configureAuth(config); err != nil {
+		return nil, "", err
+	}
+	if err := r.configureHostKey(config); err != nil {
+		return nil, "", err
+	}
+	if err := r.configureAlgorithms(config); err != nil {
+		return nil, "", err
+	}
+
+	for _, pattern := range r.values["sendenv"] {
+		config.SendEnv = append(config.SendEnv, pattern)
+	}
+
+	if v := r.first("connecttimeout"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid ConnectTimeout '%s'", v)
+		}
+		config.Timeout = time.Duration(seconds) * time.Second
+	}
+
+	if v := r.first("serveraliveinterval"); v != "" && v != "0" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid ServerAliveInterval '%s'", v)
+		}
+		keepAlive := &KeepAliveConfig{Interval: time.Duration(seconds) * time.Second}
+		if v := r.first("serveralivecountmax"); v != "" {
+			if keepAlive.MaxMissed, err = strconv.Atoi(v); err != nil {
+				return nil, "", fmt.Errorf("invalid ServerAliveCountMax '%s'", v)
+			}
+		}
+		config.KeepAlive = keepAlive
+	}
+
+	if v := r.first("proxycommand"); v != "" && strings.ToLower(v) != "none" {
+		// 参数在解析时已被拆分，按原样以空格连接
+		command, err := r.expand(strings.Join(r.values["proxycommand"], " "))
+		if err != nil {
+			return nil, "", err
+		}
+		// 已经完全展开，转义剩余的 '%' 以免被 ProxyCommandDialer 再次展开
+		config.ProxyCommand = strings.ReplaceAll(command, "%", "%%")
+	}
+
+	if v := r.first("controlpath"); v != "" && strings.ToLower(v) != "none" {
+		path, err := r.expand(v)
+		if err != nil {
+			return nil, "", err
+		}
+		config.ControlPath = strings.ReplaceAll(path, "%", "%%")
+	}
+
+	if v := r.first("proxyjump"); v != "" && strings.ToLower(v) != "none" && config.ProxyCommand == "" {
+		if depth >= maxJumpDepth {
+			return nil, "", fmt.Errorf("ProxyJump nested too deeply for '%s'", alias)
+		}
+		for _, hop := range strings.Split(v, ",") {
+			jump, err := c.resolveJump(strings.TrimSpace(hop), depth+1)
+			if err != nil {
+				return nil, "", fmt.Errorf("resolve ProxyJump '%s': %w", hop, err)
+			}
+			// 跳板机自身的跳板机链需要排在前面
+			config.JumpHosts = append(config.JumpHosts, jump.Config.JumpHosts...)
+			jump.Config.JumpHosts = nil
+			config.JumpHosts = append(config.JumpHosts, jump)
+		}
+	}
+
+	return config, addr, nil
+}
+
+// resolveJump 解析 ProxyJump 中形如 [user@]host[:port] 的一跳，host 同样会在配置文件中查找
+func (c *SSHConfig) resolveJump(hop string, depth int) (*JumpHost, error) {
+	hopUser := ""
+	if i := strings.LastIndexByte(hop, '@'); i >= 0 {
+		hopUser, hop = hop[:i], hop[i+1:]
+	}
+	host, port := hop, ""
+	if h, p, err := net.SplitHostPort(hop); err == nil {
+		host, port = h, p
+	}
+
+	config, addr, err := c.resolve(host, depth)
+	if err != nil {
+		return nil, err
+	}
+	if hopUser != "" {
+		config.User = hopUser
+	}
+	if port != "" {
+		h, _, _ := net.SplitHostPort(addr)
+		addr = net.JoinHostPort(h, port)
+	}
+	return &JumpHost{Addr: addr, Config: config}, nil
+}
+
+// configureAuth 根据 IdentityFile 与 IdentitiesOnly 设置身份认证方法
+func (r *sshConfigResolver) configureAuth(config *Config) error {
+	identities := r.values["identityfile"]
+	explicit := len(identities) > 0
+	if !explicit {
+		identities = []string{"~/.ssh/id_rsa", "~/.ssh/id_ecdsa", "~/.ssh/id_ed25519"}
+	}
+
+	var paths []string
+	for _, identity := range identities {
+		path, err := r.expand(identity)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err != nil {
+			if explicit && !os.IsNotExist(err) {
+				return err
+			}
+			// 与 Open-SSH 相同，不存在的私钥文件将被忽略
+			continue
+		}
+		paths = append(paths, path)
+	}
+	var signers []ssh.Signer
+	var encrypted []string
+	for _, path := range paths {
+		key, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		var missing *ssh.PassphraseMissingError
+		switch {
+		case err == nil:
+			signers = append(signers, signer)
+		case errors.As(err, &missing):
+			// 加密的私钥在认证时才获取口令；没有口令来源时与 BatchMode 下的 Open-SSH 相同，跳过该私钥
+			if r.passphrase != nil {
+				encrypted = append(encrypted, path)
+			}
+		default:
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+	// 客户端对同一种认证方法只尝试一次，因此加密的私钥与未加密的私钥使用同一个认证方法
+	switch {
+	case len(encrypted) > 0:
+		config.Auth = append(config.Auth, lazyKeysAuth(signers, encrypted, r.passphrase))
+	case len(signers) > 0:
+		config.Auth = append(config.Auth, publicKeysAuth(signers...))
+	}
+
+	if strings.ToLower(r.first("identitiesonly")) != "yes" && os.Getenv("SSH_AUTH_SOCK") != "" {
+		if auth, err := SSHAgentAuth(); err == nil {
+			config.Auth = append(config.Auth, auth)
+		}
+	}
+	return nil
+}
+
+// lazyKeysAuth 生成公钥认证方法，encrypted 中的私钥在认证时才解密，无法解密的私钥将被跳过；
+// 没有任何可用的私钥时返回最后一个错误。解密后的私钥由该方法持有，重连时只要私钥文件没有变化就不再询问口令
+func lazyKeysAuth(signers []ssh.Signer, encrypted []string, provider PassphraseProvider) AuthMethod {
+	identity := signersIdentity(signers) + "," + strings.Join(encrypted, ",")
+	var mu sync.Mutex
+	decrypted := make(map[string]ssh.Signer) // 以私钥文件内容的摘要为键
+	return publicKeysCallbackAuth(identity, func() ([]ssh.Signer, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		all := append([]ssh.Signer(nil), signers...)
+		var lastErr error
+		for _, file := range encrypted {
+			key, err := ioutil.ReadFile(file)
+			if err == nil {
+				sum := sha256.Sum256(key)
+				signer, ok := decrypted[string(sum[:])]
+				if !ok {
+					signer, err = parsePrivateKey(key, file, provider)
+				}
+				if err == nil {
+					decrypted[string(sum[:])] = signer
+					all = append(all, signer)
+					continue
+				}
+			}
+			lastErr = err
+		}
+		if len(all) == 0 {
+			return nil, lastErr
+		}
+		return all, nil
+	})
+}
+
+// configureHostKey 根据 UserKnownHostsFile 与 StrictHostKeyChecking 设置主机公钥验证方式
+func (r *sshConfigResolver) configureHostKey(config *Config) error {
+	switch strings.ToLower(r.first("stricthostkeychecking")) {
+	case "no", "off":
+		config.HostKeyCallback = IgnoreHostKey
+		return nil
+	}
+
+	var files []string
+	knownHosts := r.values["userknownhostsfile"]
+	if len(knownHosts) == 0 {
+		knownHosts = []string{"~/.ssh/known_hosts"}
+	}
+	for _, f := range knownHosts {
+		if strings.ToLower(f) == "none" {
+			continue
+		}
+		path, err := r.expand(f)
+		if err != nil {
+			return err
+		}
+		files = append(files, path)
+	}
+
+	// accept-new 时直接记录新的主机公钥，但仍然拒绝与记录不符的公钥；ask 以及未设置时交互式询问
+	strict := strings.ToLower(r.first("stricthostkeychecking"))
+	checker := NewKnownHostsChecker(strict != "yes" && strict != "accept-new", files...)
+	checker.AcceptNew = strict == "accept-new"
+	config.HostKeyCallback = checker.KnownHostsCheck
+	if strings.ToLower(r.first("updatehostkeys")) == "yes" && len(files) > 0 {
+		config.GlobalRequestHandlers = map[string]GlobalRequestHandler{HostKeysRequest: checker.UpdateHostKeys}
+	}
+	return nil
+}
+
+// configureAlgorithms 设置 Ciphers、KexAlgorithms、MACs 以及 HostKeyAlgorithms，
+// 支持以 '+' 追加、'-' 移除（可使用通配符）以及 '^' 前置于默认列表的写法
+func (r *sshConfigResolver) configureAlgorithms(config *Config) error {
+	var defaults ssh.Config
+	defaults.SetDefaults()
+
+	var err error
+	if v := r.first("ciphers"); v != "" {
+		if config.Ciphers, err = modifyAlgorithms(defaults.Ciphers, v); err != nil {
+			return fmt.Errorf("Ciphers: %w", err)
+		}
+	}
+	if v := r.first("kexalgorithms"); v != "" {
+		if config.KeyExchanges, err = modifyAlgorithms(defaults.KeyExchanges, v); err != nil {
+			return fmt.Errorf("KexAlgorithms: %w", err)
+		}
+	}
+	if v := r.first("macs"); v != "" {
+		if config.MACs, err = modifyAlgorithms(defaults.MACs, v); err != nil {
+			return fmt.Errorf("MACs: %w", err)
+		}
+	}
+	if v := r.first("hostkeyalgorithms"); v != "" {
+		if strings.ContainsAny(v[:1], "+-^") {
+			return errors.New("HostKeyAlgorithms: modifying the default list is not supported")
+		}
+		config.HostKeyAlgorithms = strings.Split(v, ",")
+	}
+	return nil
+}
+
+// modifyAlgorithms 根据 spec 修改默认的算法列表
+func modifyAlgorithms(defaults []string, spec string) ([]string, error) {
+	if spec == "" {
+		return nil, errors.New("empty algorithm list")
+	}
+	list := strings.Split(spec[1:], ",")
+	switch spec[0] {
+	case '+':
+		return append(append([]string(nil), defaults...), list...), nil
+	case '^':
+		return append(list, defaults...), nil
+	case '-':
+		var result []string
+		for _, algo := range defaults {
+			if !matchHostPatterns(list, algo) {
+				result = append(result, algo)
+			}
+		}
+		return result, nil
+	}
+	return strings.Split(spec, ","), nil
+}
+
+// matchHostPatterns 判断 s 是否匹配 patterns：至少匹配一个模式，且不匹配任何以 '!' 开头的否定模式，不区分大小写
+func matchHostPatterns(patterns []string, s string) bool {
+	s = strings.ToLower(s)
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		if negated {
+			pattern = pattern[1:]
+		}
+		pattern = strings.ToLower(pattern)
+		if !wildcardMatch(pattern, s) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// matchEnvPatterns 判断环境变量名称 s 是否匹配 SendEnv 中的任意一个模式，与 Open-SSH 相同，区分大小写，且不支持 '!' 否定
+func matchEnvPatterns(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if wildcardMatch(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMatch 支持 '*' 与 '?' 的通配符匹配，区分大小写
+func wildcardMatch(pattern, s string) bool {
+	// 记录最近一个 '*' 的位置以便回溯
+	p, i, star, mark := 0, 0, -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, i
+			p++
+		case star >= 0:
+			p = star + 1
+			mark++
+			i = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// expandHome 展开路径开头的 '~'
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		if u, err := user.Current(); err == nil {
+			home = u.HomeDir
+		}
+	}
+	return filepath.Join(home, path[1:])
+}
@@ -0,0 +1,322 @@
+package gossh
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSplitSSHConfigLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		keyword string
+		args    []string
+		wantErr bool
+	}{
+		{line: "HostName example.com", keyword: "hostname", args: []string{"example.com"}},
+		{line: "HostName=example.com", keyword: "hostname", args: []string{"example.com"}},
+		{line: "HostName = example.com", keyword: "hostname", args: []string{"example.com"}},
+		{line: "Port =2222", keyword: "port", args: []string{"2222"}},
+		{line: "Port= 2222", keyword: "port", args: []string{"2222"}},
+		{line: "\tPort\t=\t2222", keyword: "port", args: []string{"2222"}},
+		{line: "\tPort\t2222", keyword: "port", args: []string{"2222"}},
+		{line: "SetEnv FOO=bar", keyword: "setenv", args: []string{"FOO=bar"}},
+		{line: "SetEnv = FOO=bar", keyword: "setenv", args: []string{"FOO=bar"}},
+		{line: "LocalCommand = =x", keyword: "localcommand", args: []string{"=x"}},
+		{line: `ProxyCommand "nc %h %p" -v`, keyword: "proxycommand", args: []string{"nc %h %p", "-v"}},
+		{line: "SendEnv LANG LC_*  # locale", keyword: "sendenv", args: []string{"LANG", "LC_*"}},
+		{line: `ProxyCommand "nc`, wantErr: true},
+		{line: "   ", wantErr: true},
+	}
+	for _, tt := range tests {
+		keyword, args, err := splitSSHConfigLine(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.line, err)
+			continue
+		}
+		if keyword != tt.keyword || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%q: got %q %q, want %q %q", tt.line, keyword, args, tt.keyword, tt.args)
+		}
+	}
+}
+
+func TestResolveSSHConfigWithEquals(t *testing.T) {
+	sshConfig, err := ParseSSHConfig(strings.NewReader(`
+Host web
+	HostName = web.example.com
+	Port = 2222
+	User=deploy
+	SendEnv = LANG
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, addr, err := sshConfig.Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "web.example.com:2222" {
+		t.Errorf("addr = %q, want web.example.com:2222", addr)
+	}
+	if config.User != "deploy" {
+		t.Errorf("user = %q, want deploy", config.User)
+	}
+	if !reflect.DeepEqual(config.SendEnv, []string{"LANG"}) {
+		t.Errorf("SendEnv = %q", config.SendEnv)
+	}
+}
+
+func TestResolveSSHConfig(t *testing.T) {
+	sshConfig, err := ParseSSHConfig(strings.NewReader(`
+Host web
+	HostName web.example.com
+	Port 2222
+	User deploy
+	ProxyJump bastion
+	ConnectTimeout 5
+	ServerAliveInterval 15
+	ServerAliveCountMax 4
+
+Host bastion
+	HostName 10.0.0.1
+	User ops
+
+Host *.example.com !secret.example.com
+	User wildcard
+
+Host *
+	User fallback
+	Port 2200
+	IdentityFile /nonexistent/id_ed25519
+	IdentitiesOnly yes
+	StrictHostKeyChecking no
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, addr, err := sshConfig.Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每个参数以第一次出现的值为准
+	if addr != "web.example.com:2222" || config.User != "deploy" {
+		t.Errorf("web: addr = %q, user = %q", addr, config.User)
+	}
+	if config.Timeout != 5*time.Second {
+		t.Errorf("timeout = %s, want 5s", config.Timeout)
+	}
+	if config.KeepAlive == nil || config.KeepAlive.Interval != 15*time.Second || config.KeepAlive.MaxMissed != 4 {
+		t.Errorf("keepalive = %+v", config.KeepAlive)
+	}
+	if len(config.Auth) != 0 {
+		t.Errorf("got %d auth methods for missing identities", len(config.Auth))
+	}
+	if len(config.JumpHosts) != 1 {
+		t.Fatalf("got %d jump hosts, want 1", len(config.JumpHosts))
+	}
+	if jump := config.JumpHosts[0]; jump.Addr != "10.0.0.1:2200" || jump.Config.User != "ops" {
+		t.Errorf("jump host = %s as %s", jump.Addr, jump.Config.User)
+	}
+
+	for alias, want := range map[string]string{
+		"api.example.com":    "wildcard",
+		"secret.example.com": "fallback",
+		"other":              "fallback",
+	} {
+		config, addr, err := sshConfig.Resolve(alias)
+		if err != nil {
+			t.Errorf("%s: %v", alias, err)
+			continue
+		}
+		if config.User != want || addr != alias+":2200" {
+			t.Errorf("%s: addr = %q, user = %q, want user %q", alias, addr, config.User, want)
+		}
+	}
+}
+
+func TestResolveSSHConfigMatchFinal(t *testing.T) {
+	sshConfig, err := ParseSSHConfig(strings.NewReader(`
+Match host web.example.com final
+	User final
+
+Match canonical
+	Port 2222
+
+Match !final
+	SendEnv FIRST
+
+Host web
+	HostName web.example.com
+	SendEnv LANG LC_* TZ
+
+Host *
+	SendEnv -LC_* EXTRA
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, addr, err := sshConfig.Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Match final 只在最终求值时满足，此时 HostName 已经由第一次求值得到
+	if config.User != "final" || addr != "web.example.com:2222" {
+		t.Errorf("addr = %q, user = %q", addr, config.User)
+	}
+	// "-LC_*" 移除之前的 LC_*，最终求值不会重复添加
+	if want := []string{"FIRST", "LANG", "TZ", "EXTRA"}; !reflect.DeepEqual(config.SendEnv, want) {
+		t.Errorf("SendEnv = %q, want %q", config.SendEnv, want)
+	}
+
+	// 其它主机不满足 Match final 的条件，最终求值也不会重复添加 SendEnv
+	values, err := sshConfig.Lookup("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["user"] != nil || !reflect.DeepEqual(values["sendenv"], []string{"FIRST", "EXTRA"}) {
+		t.Errorf("other: %v", values)
+	}
+}
+
+func TestResolveSSHConfigAcceptNew(t *testing.T) {
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	sshConfig, err := ParseSSHConfig(strings.NewReader(fmt.Sprintf(`
+Host web
+	UserKnownHostsFile %s
+	StrictHostKeyChecking accept-new
+`, knownHosts)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, addr, err := sshConfig.Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 新的主机公钥不经询问直接记录，与记录不符的公钥被拒绝
+	key, remote := newTestSigner(t).PublicKey(), &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+	if err := config.HostKeyCallback(addr, remote, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.HostKeyCallback(addr, remote, key); err != nil {
+		t.Errorf("recorded host key rejected: %v", err)
+	}
+	if err := config.HostKeyCallback(addr, remote, newTestSigner(t).PublicKey()); !errors.Is(err, ErrHostKeyMismatch) {
+		t.Errorf("err = %v, want ErrHostKeyMismatch", err)
+	}
+}
+
+func TestMatchPatterns(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		s        string
+		host     bool
+		env      bool
+	}{
+		{patterns: []string{"*.example.com"}, s: "web.EXAMPLE.com", host: true, env: false},
+		{patterns: []string{"LC_*"}, s: "LC_ALL", host: true, env: true},
+		{patterns: []string{"LC_*"}, s: "lc_all", host: true, env: false},
+		{patterns: []string{"lang"}, s: "LANG", host: true, env: false},
+		{patterns: []string{"*", "!secret*"}, s: "secret_token", host: false, env: true},
+		{patterns: []string{"?ANG"}, s: "LANG", host: true, env: true},
+		{patterns: []string{"web?"}, s: "web10", host: false, env: false},
+		{patterns: []string{"!secret*"}, s: "web", host: false, env: false},
+		{patterns: []string{"db", "web"}, s: "web", host: true, env: true},
+	}
+	for _, tt := range tests {
+		if got := matchHostPatterns(tt.patterns, tt.s); got != tt.host {
+			t.Errorf("matchHostPatterns(%q, %q) = %v, want %v", tt.patterns, tt.s, got, tt.host)
+		}
+		if got := matchEnvPatterns(tt.patterns, tt.s); got != tt.env {
+			t.Errorf("matchEnvPatterns(%q, %q) = %v, want %v", tt.patterns, tt.s, got, tt.env)
+		}
+	}
+}
+
+func TestResolveSkipsEncryptedIdentities(t *testing.T) {
+	dir := t.TempDir()
+	plain, encrypted := filepath.Join(dir, "id_plain"), filepath.Join(dir, "id_encrypted")
+	key, _ := newTestPrivateKey(t)
+	if err := ioutil.WriteFile(plain, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, _ = newTestPrivateKey(t)
+	if err := ioutil.WriteFile(encrypted, encryptTestKey(t, key, "pass"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	server := startTestServer(t)
+	host, port, _ := net.SplitHostPort(server.addr)
+	sshConfig, err := ParseSSHConfig(strings.NewReader(fmt.Sprintf(`
+Host test
+	HostName %s
+	Port %s
+	User tester
+	IdentityFile %s
+	IdentityFile %s
+	IdentitiesOnly yes
+	StrictHostKeyChecking no
+`, host, port, plain, encrypted)), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有口令来源时跳过加密的私钥，解析不应失败
+	config, _, err := sshConfig.Resolve("test")
+	if err != nil {
+		t.Fatalf("Resolve with an encrypted identity: %v", err)
+	}
+	if len(config.Auth) != 1 {
+		t.Fatalf("got %d auth methods, want 1", len(config.Auth))
+	}
+
+	// 口令在认证时才被获取
+	var asked int32
+	sshConfig.Passphrase = func(file string) ([]byte, error) {
+		atomic.AddInt32(&asked, 1)
+		if file != encrypted {
+			t.Errorf("passphrase requested for %s", file)
+		}
+		return []byte("pass"), nil
+	}
+	config, addr, err := sshConfig.Resolve("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Auth) != 1 {
+		t.Fatalf("got %d auth methods, want 1", len(config.Auth))
+	}
+	if n := atomic.LoadInt32(&asked); n != 0 {
+		t.Fatalf("passphrase requested %d times during Resolve", n)
+	}
+	config.Auth = append(config.Auth, PasswordAuth(testPassword))
+	client, err := Connect(addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if n := atomic.LoadInt32(&asked); n != 1 {
+		t.Errorf("passphrase requested %d times, want 1", n)
+	}
+
+	// 同一个认证方法再次连接时使用已解密的私钥
+	if client, err = Connect(addr, config); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if n := atomic.LoadInt32(&asked); n != 1 {
+		t.Errorf("passphrase requested %d times after reconnecting, want 1", n)
+	}
+}
@@ -30,6 +30,15 @@ func KnownHostsPath(username string) (string, error) {
 	return path.Join(user.HomeDir, OpenSSHKnownHostsPath), nil
 }
 
+// SSHConfigPath 获取给定用户的默认的 Open-SSH 客户端配置文件路径
+func SSHConfigPath(username string) (string, error) {
+	user, err := user2.Lookup(username)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(user.HomeDir, OpenSSHConfigPath), nil
+}
+
 // DefaultConfigAuthByPasswd 生成默认的配置，认证方式为密码认证。
 // 不会主机公钥验证，需要后续添加 HostKeyCallback；
 // user 为登陆用户名，password 为登陆密码